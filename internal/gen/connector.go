@@ -0,0 +1,98 @@
+package gen
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/ansel1/merry/v2"
+)
+
+// Connector is a parsed connector spec. The generated main package registers a driver with Name,
+// which opens connections with the connector, returned by Package.Func.
+type Connector struct {
+	Name    string
+	Package string
+	Func    string
+	// ParsePackage and ParseFunc, if set, convert the DSN to the argument of Func. Otherwise, Func takes the DSN.
+	ParsePackage string
+	ParseFunc    string
+	// NoErr is true if Func returns only the connector, without an error
+	NoErr bool
+
+	// Alias and ParseAlias are the names of Package and ParsePackage in the generated main package.
+	// They are set by ConnectorsByName.
+	Alias      string
+	ParseAlias string
+}
+
+// ParseConnector parses a connector spec name=driver,func=package.Func[,dsn=package.ParseFunc][,noerr] e.g.
+// name=mysqlc,func=github.com/go-sql-driver/mysql.NewConnector,dsn=github.com/go-sql-driver/mysql.ParseDSN
+func ParseConnector(spec string) (Connector, error) {
+	var c Connector
+	for _, setting := range strings.Split(spec, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(setting), "=")
+		value = strings.TrimSpace(value)
+		var err error
+		switch key {
+		case "name":
+			c.Name = value
+		case "func":
+			c.Package, c.Func, err = parseSymbolRef("--connector", spec, value)
+		case "dsn":
+			c.ParsePackage, c.ParseFunc, err = parseSymbolRef("--connector", spec, value)
+		case "noerr":
+			c.NoErr = true
+		default:
+			err = merry.Errorf("invalid --connector %q: unknown setting %q", spec, setting)
+		}
+		if err != nil {
+			return c, err
+		}
+	}
+	if c.Name == "" || c.Func == "" {
+		return c, merry.Errorf("invalid --connector %q: expected format name=driver,func=package.Func[,dsn=package.ParseFunc][,noerr]", spec)
+	}
+	if strings.ContainsAny(c.Name, ":/ ") {
+		return c, merry.Errorf("invalid --connector %q: driver name %s can't contain ':', '/' or spaces", spec, c.Name)
+	}
+	return c, nil
+}
+
+// ConnectorsByName returns the parsed Connectors, sorted by name, with aliases assigned per package.
+// It assumes that the Input was validated.
+func (i Input) ConnectorsByName() []Connector {
+	var connectors []Connector
+	var packages []string
+	for _, spec := range i.Connectors {
+		c, err := ParseConnector(spec)
+		if err != nil {
+			continue
+		}
+		connectors = append(connectors, c)
+		packages = append(packages, c.Package)
+		if c.ParsePackage != "" {
+			packages = append(packages, c.ParsePackage)
+		}
+	}
+	aliases := packageAliases("connector", packages)
+	for idx := range connectors {
+		connectors[idx].Alias = aliases[connectors[idx].Package]
+		connectors[idx].ParseAlias = aliases[connectors[idx].ParsePackage]
+	}
+	slices.SortFunc(connectors, func(a, b Connector) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return connectors
+}
+
+// ConnectorImports returns the packages of Connectors by their alias
+func (i Input) ConnectorImports() map[string]string {
+	imports := make(map[string]string)
+	for _, c := range i.ConnectorsByName() {
+		imports[c.Alias] = c.Package
+		if c.ParsePackage != "" {
+			imports[c.ParseAlias] = c.ParsePackage
+		}
+	}
+	return imports
+}
@@ -3,6 +3,8 @@ package gen
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,6 +14,7 @@ import (
 	"regexp"
 	"slices"
 	"strings"
+	"sync"
 
 	"github.com/xo/dburl"
 )
@@ -241,6 +244,202 @@ func SimpleCopyWithInsert(ctx context.Context, db DB, rows *sql.Rows, table stri
 	return n, rows.Err()
 }
 
+// commonVersionQueries return the server version in many databases. VersionProbe tries them in order.
+var commonVersionQueries = []string{
+	"SELECT version()",
+	"SELECT sqlite_version()",
+	"SELECT @@version",
+	"SELECT current_version()",
+	"SELECT value FROM sys.environment WHERE name = 'monet_version'",
+	"SELECT banner FROM v$version",
+	"SELECT service_level FROM sysibmadm.env_inst_info",
+}
+
+// RowQuerier is the subset of github.com/xo/usql/drivers.DB used by VersionProbe
+type RowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// errVersionUnknown is returned by VersionProbe when none of the common version queries work
+var errVersionUnknown = errors.New("server version unknown: none of the common version queries work; configure one with usqlgen --version-query")
+
+// VersionProbe implements github.com/xo/usql/drivers.Driver.Version.
+// Unless a query is configured, it tries common version queries once and caches the first that works,
+// or that none works. Only queries stopped by a canceled context are tried again.
+type VersionProbe struct {
+	mu sync.Mutex
+	// query is the configured query, or the common query that worked, if any
+	query string
+	// unknown is true if none of the common queries worked
+	unknown bool
+}
+
+// NewVersionProbe creates a probe that uses the given query or, if empty, the common version queries
+func NewVersionProbe(query string) *VersionProbe {
+	return &VersionProbe{query: query}
+}
+
+// Version returns the server version. The lock isn't held while querying, so concurrent calls may probe
+// at the same time, until a result is cached.
+func (p *VersionProbe) Version(ctx context.Context, db RowQuerier) (string, error) {
+	p.mu.Lock()
+	query, unknown := p.query, p.unknown
+	p.mu.Unlock()
+	if unknown {
+		return "", errVersionUnknown
+	}
+	if query != "" {
+		version, err := queryVersion(ctx, db, query)
+		if err != nil {
+			return "", fmt.Errorf("failed to query server version with %q: %w", query, err)
+		}
+		return version, nil
+	}
+	for _, query := range commonVersionQueries {
+		version, err := queryVersion(ctx, db, query)
+		if err == nil {
+			p.cache(query)
+			return version, nil
+		}
+		if ctx.Err() != nil {
+			// the query was canceled, so it may work next time
+			return "", fmt.Errorf("failed to query server version with %q: %w", query, err)
+		}
+	}
+	p.cache("")
+	return "", errVersionUnknown
+}
+
+// cache records the common query that worked or, if empty, that none worked, unless a result was cached already
+func (p *VersionProbe) cache(query string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.query == "" && !p.unknown {
+		p.query = query
+		p.unknown = query == ""
+	}
+}
+
+func queryVersion(ctx context.Context, db RowQuerier, query string) (string, error) {
+	var version any
+	if err := db.QueryRowContext(ctx, query).Scan(&version); err != nil {
+		return "", err
+	}
+	return formatVersion(version), nil
+}
+
+func formatVersion(version any) string {
+	if b, ok := version.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(version)
+}
+
+// ProcessFunc matches github.com/xo/usql/drivers.Driver.Process
+type ProcessFunc func(u *dburl.URL, prefix string, sqlstr string) (string, string, bool, error)
+
+// StatementProcessor preprocesses the statements of a driver before usql executes them.
+// Process returns the statement to execute, whether it is a query, which returns rows, or an exec, and whether
+// it handled the statement. Statements that aren't handled are processed as if there were no processor.
+// Processor packages implement it without importing this package.
+type StatementProcessor interface {
+	Process(prefix string, sqlstr string) (string, bool, bool, error)
+}
+
+// ProcessWith adapts processor to a Process function. Statements, that the processor doesn't handle, are passed
+// to fallback e.g. the default semicolon handling, or classified with queryExecType, if fallback is nil.
+// queryExecType also determines the statement type, displayed by usql, of processed statements.
+func ProcessWith(processor StatementProcessor, fallback ProcessFunc, queryExecType func(prefix string, sqlstr string) (string, bool)) ProcessFunc {
+	return func(u *dburl.URL, prefix string, sqlstr string) (string, string, bool, error) {
+		processed, query, handled, err := processor.Process(prefix, sqlstr)
+		if err != nil {
+			return "", sqlstr, false, err
+		}
+		if !handled {
+			if fallback != nil {
+				return fallback(u, prefix, sqlstr)
+			}
+			typ, query := queryExecType(prefix, sqlstr)
+			return typ, sqlstr, query, nil
+		}
+		typ, _ := queryExecType(prefix, processed)
+		return typ, processed, query, nil
+	}
+}
+
+// Rewrite replaces all matches of Pattern in a statement with Replacement, which may refer to groups e.g. $1
+type Rewrite struct {
+	Pattern     string
+	Replacement string
+}
+
+// Classification marks statements, matching Pattern, as queries, which return rows, or as execs, if Query is false
+type Classification struct {
+	Pattern string
+	Query   bool
+}
+
+// StatementRules preprocess the statements of a driver before usql executes them.
+// Rewrites are applied in order. The first matching Classification overrides the classification of a statement.
+type StatementRules struct {
+	Rewrites        []Rewrite
+	Classifications []Classification
+}
+
+// Wrap returns a Process function that rewrites statements and then calls process, if not nil.
+// queryExecType classifies statements, if process is nil. Patterns must be valid regular expressions.
+func (r StatementRules) Wrap(process ProcessFunc, queryExecType func(prefix string, sqlstr string) (string, bool)) ProcessFunc {
+	rewrites := make([]*regexp.Regexp, len(r.Rewrites))
+	for idx, rewrite := range r.Rewrites {
+		rewrites[idx] = regexp.MustCompile(rewrite.Pattern)
+	}
+	classifications := make([]*regexp.Regexp, len(r.Classifications))
+	for idx, classification := range r.Classifications {
+		classifications[idx] = regexp.MustCompile(classification.Pattern)
+	}
+	return func(u *dburl.URL, prefix string, sqlstr string) (string, string, bool, error) {
+		for idx, re := range rewrites {
+			sqlstr = re.ReplaceAllString(sqlstr, r.Rewrites[idx].Replacement)
+		}
+		var typ string
+		var query bool
+		if process != nil {
+			var err error
+			typ, sqlstr, query, err = process(u, prefix, sqlstr)
+			if err != nil {
+				return typ, sqlstr, query, err
+			}
+		} else {
+			typ, query = queryExecType(prefix, sqlstr)
+		}
+		for idx, re := range classifications {
+			if re.MatchString(sqlstr) {
+				query = r.Classifications[idx].Query
+				break
+			}
+		}
+		return typ, sqlstr, query, nil
+	}
+}
+
+// ConnectorDriver adapts a connector constructor to database/sql/driver.DriverContext, so libraries,
+// that only expose connectors, can be registered with sql.Register like other drivers.
+type ConnectorDriver struct {
+	NewConnector func(dsn string) (driver.Connector, error)
+}
+
+func (d ConnectorDriver) Open(dsn string) (driver.Conn, error) {
+	connector, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(context.Background())
+}
+
+func (d ConnectorDriver) OpenConnector(dsn string) (driver.Connector, error) {
+	return d.NewConnector(dsn)
+}
+
 func StartPprofServer() {
 	// handlers must be registered separately with blank import net/http/pprof
 	address := os.Getenv("USQL_PPROF_ADDRESS")
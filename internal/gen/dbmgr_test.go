@@ -3,18 +3,22 @@ package gen_test
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/murfffi/gorich/helperr"
 	"github.com/sclgo/usqlgen/internal/gen"
 	"github.com/stretchr/testify/require"
+	"github.com/xo/dburl"
 
 	// drivers
 	_ "github.com/mithrandie/csvq-driver"
-	_ "modernc.org/sqlite"
+	"modernc.org/sqlite"
 )
 
 const sqliteNumInputRows = 100
@@ -202,3 +206,207 @@ func (d testDb) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, erro
 	}
 	return d.DB.BeginTx(ctx, opts)
 }
+
+// countingDb counts queries
+type countingDb struct {
+	*sql.DB
+	queries atomic.Int32
+}
+
+func (d *countingDb) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	d.queries.Add(1)
+	return d.DB.QueryRowContext(ctx, query, args...)
+}
+
+func TestVersionProbe(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer helperr.CloseQuietly(db)
+
+	t.Run("common queries", func(t *testing.T) {
+		probe := gen.NewVersionProbe("")
+		version, err := probe.Version(t.Context(), db)
+		require.NoError(t, err)
+		require.Regexp(t, `^3\.\d+\.\d+$`, version)
+
+		// the working query is cached, so the probe now fails on databases that don't support it
+		csvqDb, err := sql.Open("csvq", t.TempDir())
+		require.NoError(t, err)
+		defer helperr.CloseQuietly(csvqDb)
+		_, err = probe.Version(t.Context(), csvqDb)
+		require.ErrorContains(t, err, "sqlite_version()")
+	})
+
+	t.Run("configured query", func(t *testing.T) {
+		probe := gen.NewVersionProbe("SELECT 'v' || sqlite_version()")
+		version, err := probe.Version(t.Context(), db)
+		require.NoError(t, err)
+		require.Regexp(t, `^v3\.`, version)
+	})
+
+	t.Run("failure is cached", func(t *testing.T) {
+		csvqDb, err := sql.Open("csvq", t.TempDir())
+		require.NoError(t, err)
+		defer helperr.CloseQuietly(csvqDb)
+		counting := &countingDb{DB: csvqDb}
+		probe := gen.NewVersionProbe("")
+		_, err = probe.Version(t.Context(), counting)
+		require.ErrorContains(t, err, "--version-query")
+		queries := counting.queries.Load()
+		require.Positive(t, queries)
+
+		_, err = probe.Version(t.Context(), counting)
+		require.ErrorContains(t, err, "--version-query")
+		require.Equal(t, queries, counting.queries.Load())
+	})
+
+	t.Run("canceled probe is retried", func(t *testing.T) {
+		probe := gen.NewVersionProbe("")
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		_, err := probe.Version(ctx, db)
+		require.ErrorIs(t, err, context.Canceled)
+
+		version, err := probe.Version(t.Context(), db)
+		require.NoError(t, err)
+		require.Regexp(t, `^3\.\d+\.\d+$`, version)
+	})
+
+	t.Run("no query works", func(t *testing.T) {
+		csvqDb, err := sql.Open("csvq", t.TempDir())
+		require.NoError(t, err)
+		defer helperr.CloseQuietly(csvqDb)
+		_, err = gen.NewVersionProbe("").Version(t.Context(), csvqDb)
+		require.ErrorContains(t, err, "--version-query")
+	})
+}
+
+func TestStatementRules_Wrap(t *testing.T) {
+	rules := gen.StatementRules{
+		Rewrites: []gen.Rewrite{
+			{Pattern: `(?im)^\s*GO\s*$`, Replacement: ""},
+			{Pattern: `(?is)^\s*SELECT (.*) LIMIT (\d+)\s*$`, Replacement: "SELECT TOP $2 $1"},
+		},
+		Classifications: []gen.Classification{
+			{Pattern: `(?i)^\s*EXEC sp_help`, Query: true},
+			{Pattern: `(?i)^\s*EXEC`, Query: false},
+		},
+	}
+	queryExecType := func(prefix string, _ string) (string, bool) {
+		return prefix, prefix == "SELECT"
+	}
+
+	t.Run("without process", func(t *testing.T) {
+		process := rules.Wrap(nil, queryExecType)
+		typ, sqlstr, query, err := process(nil, "SELECT", "SELECT a, b FROM t LIMIT 10\nGO\n")
+		require.NoError(t, err)
+		require.Equal(t, "SELECT", typ)
+		require.Equal(t, "SELECT TOP 10 a, b FROM t", sqlstr)
+		require.True(t, query)
+
+		_, _, query, err = process(nil, "EXEC", "EXEC sp_help 't'")
+		require.NoError(t, err)
+		require.True(t, query)
+
+		_, _, query, err = process(nil, "EXEC", "EXEC sp_rename 't', 'u'")
+		require.NoError(t, err)
+		require.False(t, query)
+	})
+
+	t.Run("with process", func(t *testing.T) {
+		process := rules.Wrap(func(_ *dburl.URL, prefix string, sqlstr string) (string, string, bool, error) {
+			return prefix, sqlstr + ";", false, nil
+		}, queryExecType)
+		_, sqlstr, query, err := process(nil, "EXEC", "EXEC sp_help\nGO")
+		require.NoError(t, err)
+		require.Equal(t, "EXEC sp_help\n;", sqlstr)
+		require.True(t, query)
+	})
+}
+
+// upperProcessor handles SHOW statements only
+type upperProcessor struct{}
+
+func (upperProcessor) Process(prefix string, sqlstr string) (string, bool, bool, error) {
+	if sqlstr == "" {
+		return "", false, false, errors.New("empty statement")
+	}
+	if prefix != "SHOW" {
+		return sqlstr, false, false, nil
+	}
+	return strings.ToUpper(sqlstr), true, true, nil
+}
+
+func TestProcessWith(t *testing.T) {
+	queryExecType := func(prefix string, _ string) (string, bool) {
+		return prefix, prefix == "SELECT"
+	}
+	trimSemicolon := func(_ *dburl.URL, prefix string, sqlstr string) (string, string, bool, error) {
+		typ, query := queryExecType(prefix, sqlstr)
+		return typ, gen.SemicolonEndRE.ReplaceAllString(sqlstr, ""), query, nil
+	}
+
+	t.Run("handled", func(t *testing.T) {
+		process := gen.ProcessWith(upperProcessor{}, trimSemicolon, queryExecType)
+		typ, sqlstr, query, err := process(nil, "SHOW", "show tables;")
+		require.NoError(t, err)
+		require.Equal(t, "SHOW", typ)
+		require.Equal(t, "SHOW TABLES;", sqlstr)
+		require.True(t, query)
+
+		_, _, _, err = process(nil, "", "")
+		require.ErrorContains(t, err, "empty statement")
+	})
+
+	t.Run("declined", func(t *testing.T) {
+		process := gen.ProcessWith(upperProcessor{}, trimSemicolon, queryExecType)
+		typ, sqlstr, query, err := process(nil, "SELECT", "select 1;")
+		require.NoError(t, err)
+		require.Equal(t, "SELECT", typ)
+		require.Equal(t, "select 1", sqlstr)
+		require.True(t, query)
+	})
+
+	t.Run("declined without fallback", func(t *testing.T) {
+		process := gen.ProcessWith(upperProcessor{}, nil, queryExecType)
+		_, sqlstr, query, err := process(nil, "SELECT", "select 1;")
+		require.NoError(t, err)
+		require.Equal(t, "select 1;", sqlstr)
+		require.True(t, query)
+	})
+}
+
+// dsnConnector is a minimal driver.Connector, like the ones returned by connector-only libraries
+type dsnConnector struct {
+	dsn string
+	drv driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.drv.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.drv
+}
+
+func TestConnectorDriver(t *testing.T) {
+	sql.Register("sqlite_connector_test", gen.ConnectorDriver{NewConnector: func(dsn string) (driver.Connector, error) {
+		if dsn == "" {
+			return nil, errors.New("empty dsn")
+		}
+		return dsnConnector{dsn: dsn, drv: &sqlite.Driver{}}, nil
+	}})
+
+	db, err := sql.Open("sqlite_connector_test", ":memory:")
+	require.NoError(t, err)
+	defer helperr.CloseQuietly(db)
+	var result int
+	require.NoError(t, db.QueryRowContext(t.Context(), "SELECT 1").Scan(&result))
+	require.Equal(t, 1, result)
+
+	_, err = gen.ConnectorDriver{NewConnector: func(string) (driver.Connector, error) {
+		return nil, errors.New("empty dsn")
+	}}.Open("")
+	require.ErrorContains(t, err, "empty dsn")
+}
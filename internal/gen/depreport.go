@@ -0,0 +1,253 @@
+package gen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/ansel1/merry/v2"
+	"github.com/sclgo/usqlgen/internal/run"
+	"golang.org/x/mod/semver"
+)
+
+// ChangeKind describes how a module changed between the build list of the original usql module and the generated one
+type ChangeKind string
+
+const (
+	Added      ChangeKind = "added"
+	Upgraded   ChangeKind = "upgraded"
+	Downgraded ChangeKind = "downgraded"
+	Replaced   ChangeKind = "replaced"
+)
+
+// Module is a module in a build list, as listed by go list -m
+type Module struct {
+	Path    string  `json:"path"`
+	Version string  `json:"version,omitempty"`
+	Replace *Module `json:"replace,omitempty"`
+	Main    bool    `json:"-"`
+}
+
+// String formats the module as in go.mod e.g. example.com/a v1.0.0 or ../a
+func (m *Module) String() string {
+	if m == nil {
+		return ""
+	}
+	return strings.TrimSpace(m.Path + " " + m.Version)
+}
+
+// DependencyChange is a module that was added, upgraded, downgraded or replaced compared to the original usql
+// build list
+type DependencyChange struct {
+	Module string     `json:"module"`
+	Kind   ChangeKind `json:"kind"`
+	// Before is empty if the module was added
+	Before string `json:"before,omitempty"`
+	After  string `json:"after"`
+	// Replacement is the module that replaces Module in the generated build list, if Kind is Replaced
+	Replacement string `json:"replacement,omitempty"`
+	// Drivers lists the built-in usql driver packages, relative to the usql module, that depend on Module
+	Drivers []string `json:"drivers,omitempty"`
+}
+
+// DependencyReport lists the changes that imports, gets, replaces, etc. made to the dependencies of usql
+type DependencyReport struct {
+	Changes []DependencyChange `json:"changes"`
+}
+
+// Report compares the build list of the downloaded usql module with the build list of the generated module in
+// workingDir. If the generated code wasn't compiled yet, go.mod is updated with -mod=mod, as the compilation would.
+// build contains the environment and the build flags of the compilation, so only drivers, included in the build,
+// are reported as affected by changes.
+func Report(ctx context.Context, workingDir string, original []Module, build BuildOptions) (DependencyReport, error) {
+	var report DependencyReport
+	drivers, err := listDriverDeps(ctx, workingDir, build)
+	if err != nil {
+		return report, err
+	}
+	final, err := listModules(ctx, workingDir, "-mod=mod")
+	if err != nil {
+		return report, err
+	}
+
+	report.Changes = diffBuildLists(original, final)
+	modulePaths := make([]string, 0, len(final))
+	var usqlModule string
+	for _, m := range final {
+		if m.Main {
+			usqlModule = m.Path
+		} else {
+			modulePaths = append(modulePaths, m.Path)
+		}
+	}
+	for idx := range report.Changes {
+		report.Changes[idx].Drivers = dependentDrivers(report.Changes[idx].Module, modulePaths, drivers, usqlModule)
+	}
+	return report, nil
+}
+
+// listModules returns the build list of the module in dir, using the given -mod flag
+func listModules(ctx context.Context, dir string, modFlag string) ([]Module, error) {
+	var output bytes.Buffer
+	err := run.Command{
+		Dir:    dir,
+		GoBin:  run.FindGo(),
+		Args:   []string{"list", modFlag, "-m", "-json", "all"},
+		Stdout: &output,
+	}.Run(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var modules []Module
+	decoder := json.NewDecoder(&output)
+	for {
+		var listed struct {
+			Path    string
+			Version string
+			Main    bool
+			Replace *struct {
+				Path    string
+				Version string
+			}
+		}
+		err = decoder.Decode(&listed)
+		if errors.Is(err, io.EOF) {
+			return modules, nil
+		}
+		if err != nil {
+			return nil, merry.Wrap(err)
+		}
+		m := Module{Path: listed.Path, Version: listed.Version, Main: listed.Main}
+		if listed.Replace != nil {
+			m.Replace = &Module{Path: listed.Replace.Path, Version: listed.Replace.Version}
+		}
+		modules = append(modules, m)
+	}
+}
+
+// diffBuildLists returns the modules of final that have a different version or replacement than in original
+func diffBuildLists(original []Module, final []Module) []DependencyChange {
+	before := make(map[string]Module, len(original))
+	for _, m := range original {
+		before[m.Path] = m
+	}
+
+	var changes []DependencyChange
+	for _, m := range final {
+		if m.Main {
+			continue
+		}
+		prev := before[m.Path]
+		change := DependencyChange{Module: m.Path, Before: prev.Version, After: m.Version}
+		switch cmp := semver.Compare(change.After, change.Before); {
+		case m.Replace != nil && m.Replace.String() != prev.Replace.String():
+			change.Kind = Replaced
+			change.Replacement = m.Replace.String()
+		case change.Before == "":
+			change.Kind = Added
+		case cmp > 0:
+			change.Kind = Upgraded
+		case cmp < 0:
+			change.Kind = Downgraded
+		default:
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// driverPackage is the output of go list for a usql driver package
+type driverPackage struct {
+	ImportPath string
+	Deps       []string
+}
+
+// listDriverDeps lists the packages linked into the generated main package, including usql driver packages,
+// with their dependencies. build selects the same packages and files as the compilation e.g. with -tags.
+func listDriverDeps(ctx context.Context, workingDir string, build BuildOptions) ([]driverPackage, error) {
+	var output bytes.Buffer
+	args := []string{"list", "-mod=mod", "-e", "-deps", "-json=ImportPath,Deps"}
+	args = append(args, build.Flags...)
+	err := run.Command{
+		Dir:    workingDir,
+		AddEnv: build.Env,
+		GoBin:  run.FindGo(),
+		Args:   append(args, "."),
+		Stdout: &output,
+	}.Run(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []driverPackage
+	decoder := json.NewDecoder(&output)
+	for {
+		var pkg driverPackage
+		err = decoder.Decode(&pkg)
+		if errors.Is(err, io.EOF) {
+			return packages, nil
+		}
+		if err != nil {
+			return nil, merry.Wrap(err)
+		}
+		packages = append(packages, pkg)
+	}
+}
+
+// dependentDrivers returns the driver packages, relative to usqlModule, with a dependency in the given module.
+// Import paths are attributed to the required module with the longest matching path.
+func dependentDrivers(module string, modulePaths []string, drivers []driverPackage, usqlModule string) []string {
+	driversPrefix := usqlModule + "/drivers/"
+	var result []string
+	for _, pkg := range drivers {
+		if !strings.HasPrefix(pkg.ImportPath, driversPrefix) {
+			continue
+		}
+		if slices.ContainsFunc(pkg.Deps, func(dep string) bool {
+			return moduleOf(dep, modulePaths) == module
+		}) {
+			result = append(result, strings.TrimPrefix(pkg.ImportPath, usqlModule+"/"))
+		}
+	}
+	return result
+}
+
+func moduleOf(importPath string, modulePaths []string) string {
+	var longest string
+	for _, path := range modulePaths {
+		if (importPath == path || strings.HasPrefix(importPath, path+"/")) && len(path) > len(longest) {
+			longest = path
+		}
+	}
+	return longest
+}
+
+// Text formats the report for display
+func (r DependencyReport) Text() string {
+	if len(r.Changes) == 0 {
+		return "usql dependencies: no changes to the original build list\n"
+	}
+	var sb strings.Builder
+	sb.WriteString("usql dependencies changed compared to the original build list:\n")
+	for _, change := range r.Changes {
+		switch change.Kind {
+		case Added:
+			_, _ = fmt.Fprintf(&sb, "  %s %s %s\n", change.Kind, change.Module, change.After)
+		case Replaced:
+			_, _ = fmt.Fprintf(&sb, "  %s %s %s => %s\n", change.Kind, change.Module, change.After, change.Replacement)
+		default:
+			_, _ = fmt.Fprintf(&sb, "  %s %s %s => %s\n", change.Kind, change.Module, change.Before, change.After)
+		}
+		if len(change.Drivers) > 0 {
+			_, _ = fmt.Fprintf(&sb, "    used by built-in drivers: %s\n", strings.Join(change.Drivers, ", "))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,104 @@
+package gen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffBuildLists(t *testing.T) {
+	original := []Module{
+		{Path: "github.com/xo/usql", Main: true},
+		{Path: "github.com/microsoft/go-mssqldb", Version: "v1.8.0"},
+		{Path: "google.golang.org/grpc", Version: "v1.60.0"},
+		{Path: "google.golang.org/protobuf", Version: "v1.33.0"},
+		{Path: "golang.org/x/crypto", Version: "v0.30.0"},
+	}
+	final := []Module{
+		{Path: "github.com/xo/usql", Main: true},
+		{Path: "github.com/MonetDB/MonetDB-Go/v2", Version: "v2.0.1"},
+		{Path: "github.com/microsoft/go-mssqldb", Version: "v1.8.0", Replace: &Module{Path: "github.com/dlapko/go-mssqldb", Version: "v1.0.0"}},
+		{Path: "google.golang.org/grpc", Version: "v1.65.0"},
+		{Path: "google.golang.org/protobuf", Version: "v1.33.0"},
+		{Path: "golang.org/x/crypto", Version: "v0.29.0"},
+	}
+	require.Equal(t, []DependencyChange{
+		{Module: "github.com/MonetDB/MonetDB-Go/v2", Kind: Added, After: "v2.0.1"},
+		{Module: "github.com/microsoft/go-mssqldb", Kind: Replaced, Before: "v1.8.0", After: "v1.8.0", Replacement: "github.com/dlapko/go-mssqldb v1.0.0"},
+		{Module: "google.golang.org/grpc", Kind: Upgraded, Before: "v1.60.0", After: "v1.65.0"},
+		{Module: "golang.org/x/crypto", Kind: Downgraded, Before: "v0.30.0", After: "v0.29.0"},
+	}, diffBuildLists(original, final))
+}
+
+func TestListModules(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "go.mod"), "module example.com/main\n\ngo 1.22\n\n"+
+		"require example.com/a v1.0.0\n\nreplace example.com/a => ./a\n")
+	writeTestFile(t, filepath.Join(dir, "a", "go.mod"), "module example.com/a\n\ngo 1.22\n")
+
+	modules, err := listModules(t.Context(), dir, "-mod=readonly")
+	require.NoError(t, err)
+	require.Equal(t, []Module{
+		{Path: "example.com/main", Main: true},
+		{Path: "example.com/a", Version: "v1.0.0", Replace: &Module{Path: "./a"}},
+	}, modules)
+}
+
+func writeTestFile(t *testing.T, path string, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), fileMode))
+	require.NoError(t, os.WriteFile(path, []byte(content), fileMode))
+}
+
+func TestDependentDrivers(t *testing.T) {
+	modulePaths := []string{"cloud.google.com/go", "cloud.google.com/go/spanner", "google.golang.org/grpc"}
+	drivers := []driverPackage{
+		{ImportPath: "github.com/xo/usql", Deps: []string{"google.golang.org/grpc"}},
+		{ImportPath: "github.com/xo/usql/drivers/spanner", Deps: []string{"cloud.google.com/go/spanner", "google.golang.org/grpc/codes"}},
+		{ImportPath: "github.com/xo/usql/drivers/bigquery", Deps: []string{"cloud.google.com/go/bigquery", "google.golang.org/grpc"}},
+		{ImportPath: "github.com/xo/usql/drivers/postgres", Deps: []string{"github.com/lib/pq"}},
+	}
+	require.Equal(t, []string{"drivers/spanner", "drivers/bigquery"},
+		dependentDrivers("google.golang.org/grpc", modulePaths, drivers, "github.com/xo/usql"))
+	require.Equal(t, []string{"drivers/bigquery"},
+		dependentDrivers("cloud.google.com/go", modulePaths, drivers, "github.com/xo/usql"))
+}
+
+func TestListDriverDeps(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":                 "module github.com/xo/usql\n\ngo 1.23\n",
+		"main.go":                "package main\n\nimport _ \"github.com/xo/usql/internal\"\n\nfunc main() {}\n",
+		"internal/internal.go":   "package internal\n",
+		"internal/alpha.go":      "//go:build !no_alpha\n\npackage internal\n\nimport _ \"github.com/xo/usql/drivers/alpha\"\n",
+		"internal/beta.go":       "//go:build !no_beta\n\npackage internal\n\nimport _ \"github.com/xo/usql/drivers/beta\"\n",
+		"drivers/alpha/alpha.go": "package alpha\n",
+		"drivers/beta/beta.go":   "package beta\n",
+	}
+	for name, content := range files {
+		writeTestFile(t, filepath.Join(dir, name), content)
+	}
+
+	packages, err := listDriverDeps(t.Context(), dir, BuildOptions{Flags: []string{"-tags", "no_beta"}})
+	require.NoError(t, err)
+	importPaths := lo.Map(packages, func(pkg driverPackage, _ int) string {
+		return pkg.ImportPath
+	})
+	require.Contains(t, importPaths, "github.com/xo/usql/drivers/alpha")
+	require.NotContains(t, importPaths, "github.com/xo/usql/drivers/beta")
+}
+
+func TestDependencyReport_Text(t *testing.T) {
+	report := DependencyReport{Changes: []DependencyChange{
+		{Module: "google.golang.org/grpc", Kind: Upgraded, Before: "v1.60.0", After: "v1.65.0", Drivers: []string{"drivers/spanner"}},
+	}}
+	require.Equal(t, "usql dependencies changed compared to the original build list:\n"+
+		"  upgraded google.golang.org/grpc v1.60.0 => v1.65.0\n"+
+		"    used by built-in drivers: drivers/spanner\n", report.Text())
+	require.Contains(t, DependencyReport{Changes: []DependencyChange{
+		{Module: "github.com/microsoft/go-mssqldb", Kind: Replaced, Before: "v1.8.0", After: "v1.8.0", Replacement: "../go-mssqldb"},
+	}}.Text(), "  replaced github.com/microsoft/go-mssqldb v1.8.0 => ../go-mssqldb\n")
+	require.Contains(t, DependencyReport{}.Text(), "no changes")
+}
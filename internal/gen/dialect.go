@@ -0,0 +1,75 @@
+package gen
+
+import (
+	"strings"
+
+	"github.com/ansel1/merry/v2"
+)
+
+// Dialect configures how usql highlights and splits SQL for an imported driver.
+// Fields match the respective fields of github.com/xo/usql/drivers.Driver.
+type Dialect struct {
+	// LexerName is the name of the chroma lexer for syntax highlighting e.g. mysql
+	LexerName              string
+	AllowDollar            bool
+	AllowMultilineComments bool
+	AllowCComments         bool
+	AllowHashComments      bool
+	// BatchQueryPrefixes maps prefixes of statements, which contain semicolons e.g. CREATE PROCEDURE,
+	// to the keyword that ends them
+	BatchQueryPrefixes map[string]string
+}
+
+// dialectFlags are the boolean settings of --dialect
+var dialectFlags = map[string]func(*Dialect){
+	"allow-dollar":             func(d *Dialect) { d.AllowDollar = true },
+	"allow-multiline-comments": func(d *Dialect) { d.AllowMultilineComments = true },
+	"allow-c-comments":         func(d *Dialect) { d.AllowCComments = true },
+	"allow-hash-comments":      func(d *Dialect) { d.AllowHashComments = true },
+}
+
+// ParseDialect parses a dialect spec driver:setting[,setting...], where setting is one of lexer=name,
+// allow-dollar, allow-multiline-comments, allow-c-comments, allow-hash-comments or batch=prefix:end
+func ParseDialect(spec string) (string, Dialect, error) {
+	var dialect Dialect
+	driver, settings, found := strings.Cut(spec, ":")
+	driver = strings.TrimSpace(driver)
+	if !found || driver == "" {
+		return driver, dialect, merry.Errorf("invalid --dialect %q: expected format driver:setting[,setting...]", spec)
+	}
+	for _, setting := range strings.Split(settings, ",") {
+		setting = strings.TrimSpace(setting)
+		key, value, hasValue := strings.Cut(setting, "=")
+		switch {
+		case key == "lexer" && value != "":
+			dialect.LexerName = value
+		case key == "batch" && hasValue:
+			prefix, end, ok := strings.Cut(value, ":")
+			prefix, end = strings.TrimSpace(prefix), strings.TrimSpace(end)
+			if !ok || prefix == "" || end == "" {
+				return driver, dialect, merry.Errorf("invalid --dialect %q: expected batch=prefix:end e.g. batch=CREATE PROCEDURE:END", spec)
+			}
+			if dialect.BatchQueryPrefixes == nil {
+				dialect.BatchQueryPrefixes = make(map[string]string)
+			}
+			dialect.BatchQueryPrefixes[strings.ToUpper(prefix)] = strings.ToUpper(end)
+		case dialectFlags[setting] != nil:
+			dialectFlags[setting](&dialect)
+		default:
+			return driver, dialect, merry.Errorf("invalid --dialect %q: unknown setting %q", spec, setting)
+		}
+	}
+	return driver, dialect, nil
+}
+
+// DialectsByDriver returns the parsed Dialects by driver name. It assumes that the Input was validated.
+func (i Input) DialectsByDriver() map[string]Dialect {
+	dialects := make(map[string]Dialect, len(i.Dialects))
+	for _, spec := range i.Dialects {
+		driver, dialect, err := ParseDialect(spec)
+		if err == nil {
+			dialects[driver] = dialect
+		}
+	}
+	return dialects
+}
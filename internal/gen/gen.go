@@ -2,15 +2,15 @@ package gen
 
 import (
 	"bytes"
+	"context"
 	_ "embed"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"text/template"
+	"strings"
 
 	"github.com/ansel1/merry/v2"
 	"github.com/murfffi/gorich/helperr"
@@ -32,8 +32,53 @@ type Input struct {
 	// Caller should remove duplicates if needed.
 	Imports []string
 
-	Replaces    []string
-	Gets        []string
+	Replaces []string
+	Gets     []string
+	// Likes lists new=builtin pairs. The imported driver new is registered with the usql configuration
+	// of the built-in driver e.g. pgx=postgres, instead of the generic configuration.
+	Likes []string
+	// Dialects lists driver:settings specs, parsed with ParseDialect, that configure how usql highlights and
+	// splits SQL for imported drivers
+	Dialects []string
+	// VersionQueries lists driver:query pairs. usql runs the query to get the server version of the driver
+	// e.g. in \conninfo. Imported drivers without a query use VersionProbe.
+	VersionQueries []string
+	// Rewrites lists driver:/pattern/replacement/ specs, parsed with ParseRewrite, applied in order to statements
+	// of imported drivers
+	Rewrites []string
+	// Classifications lists driver:query=pattern and driver:exec=pattern specs, parsed with ParseClassification,
+	// that override whether statements of imported drivers are executed as queries
+	Classifications []string
+	// Processors lists driver:package.Symbol specs, parsed with ParseProcessor. The StatementProcessor Symbol
+	// preprocesses statements of driver. Statements it doesn't handle get the default semicolon handling.
+	Processors []string
+	// InitFiles lists Go source files in package main, added to the generated main package e.g. with init
+	// functions that configure drivers
+	InitFiles []string
+	// InitSnippets lists Go statements, each run in an init function of the generated main package, before
+	// new drivers are registered with usql. Packages they refer to are imported automatically.
+	InitSnippets []string
+	// Connectors lists connector specs, parsed with ParseConnector, for libraries that don't register
+	// database/sql drivers
+	Connectors []string
+	// Variables lists NAME=VALUE defaults of usql variables, like \set NAME VALUE
+	Variables []string
+	// PrintVariables lists NAME=VALUE defaults of usql print options, like \pset NAME VALUE
+	PrintVariables []string
+	// EnvDefaults lists NAME=VALUE defaults of environment variables of usql, applied only if they are not set
+	EnvDefaults []string
+	// Patches lists unified diff files, applied to the downloaded usql code before usqlgen changes it
+	Patches []string
+	// Excludes lists module@version pairs, added as exclude directives to the generated go.mod
+	Excludes []string
+	// Toolchain, if set, is written as the toolchain line of the generated go.mod e.g. go1.23.4
+	Toolchain string
+	// PGOProfile, if set, is the path to a CPU profile, copied as default.pgo to the main package
+	// for profile-guided optimization
+	PGOProfile string
+	// MainTemplate, if set, is the path to a text/template that replaces the default template of new_main.go
+	MainTemplate string
+
 	WorkingDir  string
 	USQLModule  string
 	USQLVersion string
@@ -41,6 +86,13 @@ type Input struct {
 	IncludeSemicolon bool
 	KeepCgo          bool
 
+	// NoTidy skips go mod tidy after go.mod is edited. It is safe if the generated code is compiled
+	// with -mod=mod, which updates go.mod and go.sum as needed.
+	NoTidy bool
+
+	// NoDependencyReport skips listing the build list of the downloaded usql module, which Report needs
+	NoDependencyReport bool
+
 	// MainOpts values control the overall main.go generation, not
 	// imported drivers
 	MainOpts MainOptions
@@ -52,46 +104,82 @@ type MainOptions struct {
 
 type Result struct {
 	DownloadedUsqlVersion string
+	// OriginalModules is the build list of the downloaded usql module, before any changes, for Report.
+	// It is empty if NoDependencyReport is set.
+	OriginalModules []Module
+}
+
+// parseLike parses a --like spec new=builtin e.g. pgx=postgres
+func parseLike(spec string) (string, string, error) {
+	driver, builtin, found := strings.Cut(spec, "=")
+	driver, builtin = strings.TrimSpace(driver), strings.TrimSpace(builtin)
+	if !found || driver == "" || builtin == "" {
+		return "", "", merry.Errorf("invalid --like %q: expected format new=builtin e.g. pgx=postgres", spec)
+	}
+	return driver, builtin, nil
 }
 
-func (i Input) Main(w io.Writer) error {
-	tpl := template.Must(template.New("main").Parse(mainTpl))
-	return merry.Wrap(tpl.Execute(w, i))
+// LikeDrivers returns Likes as a map from the new driver to the built-in driver. It assumes that the Input was validated.
+func (i Input) LikeDrivers() map[string]string {
+	likes := make(map[string]string, len(i.Likes))
+	for _, spec := range i.Likes {
+		driver, builtin, err := parseLike(spec)
+		if err == nil {
+			likes[driver] = builtin
+		}
+	}
+	return likes
+}
+
+// parseVersionQuery parses a --version-query spec driver:query e.g. "sqlite3:SELECT sqlite_version()"
+func parseVersionQuery(spec string) (string, string, error) {
+	driver, query, found := strings.Cut(spec, ":")
+	driver, query = strings.TrimSpace(driver), strings.TrimSpace(query)
+	if !found || driver == "" || query == "" {
+		return "", "", merry.Errorf("invalid --version-query %q: expected format driver:query e.g. \"sqlite3:SELECT sqlite_version()\"", spec)
+	}
+	return driver, query, nil
 }
 
-// AllDownload generates all usql distribution code using the go mod download strategy
-func (i Input) AllDownload() (Result, error) {
+// VersionQueriesByDriver returns VersionQueries as a map from driver to query. It assumes that the Input was validated.
+func (i Input) VersionQueriesByDriver() map[string]string {
+	queries := make(map[string]string, len(i.VersionQueries))
+	for _, spec := range i.VersionQueries {
+		driver, query, err := parseVersionQuery(spec)
+		if err == nil {
+			queries[driver] = query
+		}
+	}
+	return queries
+}
+
+// AllDownload generates all usql distribution code using the go mod download strategy.
+// go commands, started in the process, are stopped if ctx is done.
+func (i Input) AllDownload(ctx context.Context) (Result, error) {
 	var result Result
-	err := os.MkdirAll(i.WorkingDir, fileMode)
+	err := i.Validate()
 	if err != nil {
-		return result, merry.Wrap(err)
+		return result, err
 	}
 
-	cmd := exec.Command("go", "mod", "download", "-json", i.getUSQLModuleVersion())
-	cmd.Dir = i.WorkingDir
-	var outputBuf, errorBuf bytes.Buffer
-	cmd.Stdout = &outputBuf
-	cmd.Stderr = io.MultiWriter(&errorBuf, os.Stderr)
-	err = cmd.Run()
+	err = os.MkdirAll(i.WorkingDir, fileMode)
 	if err != nil {
-		var exitErr *exec.ExitError
-		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 || outputBuf.Len() > 0 {
-			return result, merry.Wrap(err, merry.AppendMessagef("while running go mod download with stdout length %d and stderr output \n%s", outputBuf.Len(), &errorBuf))
-		}
-		// We ignore exit code 1 with non-empty output, because this indicates a partial success of
-		// go mod download command and that the package was likely successfully downloaded.
-		// This case happens frequently.
-		// https://github.com/golang/go/issues/35380 is about a different issue but some comments
-		// cover this case.
+		return result, merry.Wrap(err)
 	}
 
 	var downloadInfo map[string]any
-	err = json.NewDecoder(&outputBuf).Decode(&downloadInfo)
+	err = run.Step("download", func() error {
+		var downloadErr error
+		downloadInfo, downloadErr = i.download(ctx)
+		return downloadErr
+	})
 	if err != nil {
-		return result, merry.Wrap(err)
+		return result, err
 	}
 
-	err = i.copyOriginal(downloadInfo)
+	err = run.Step("copy", func() error {
+		return i.copyOriginal(downloadInfo)
+	})
 	if err != nil {
 		return result, err
 	}
@@ -100,14 +188,45 @@ func (i Input) AllDownload() (Result, error) {
 	if downloadedVersion, ok := downloadInfo["Version"]; ok {
 		result.DownloadedUsqlVersion = fmt.Sprint(downloadedVersion)
 	}
+	if !i.NoDependencyReport {
+		err = run.Step("list modules", func() error {
+			var listErr error
+			result.OriginalModules, listErr = listModules(ctx, i.WorkingDir, "-mod=readonly")
+			return listErr
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if len(i.Patches) > 0 {
+		err = run.Step("apply patches", func() error {
+			return i.applyPatches(result.DownloadedUsqlVersion)
+		})
+		if err != nil {
+			return result, err
+		}
+	}
 
 	// We expect that the DownloadedUsqlVersion is already uses a Go version
 	// no older the version usqlgen expects.
 	// Otherwise, we would need to edit the generated go.mod to ensure that
 	// go version matches the code we inject.
 
+	// usql patches are verified before the slower steps, so unsupported usql versions fail early
 	if i.shouldReplaceMain() {
-		err = i.replaceMain()
+		err = run.Step("patch main", func() error {
+			return i.replaceMain(result.DownloadedUsqlVersion)
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if !i.KeepCgo {
+		err = run.Step("patch cgo tags", func() error {
+			return i.adjustCgoTags(result.DownloadedUsqlVersion)
+		})
 		if err != nil {
 			return result, err
 		}
@@ -122,28 +241,58 @@ func (i Input) AllDownload() (Result, error) {
 		return result, err
 	}
 
-	err = i.doGoGet()
-	if err != nil {
-		return result, err
+	if len(i.InitFiles) > 0 || len(i.InitSnippets) > 0 {
+		err = run.Step("add init code", func() error {
+			return i.populateInit(ctx)
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if i.PGOProfile != "" {
+		err = run.Step("copy profile", i.copyProfile)
+		if err != nil {
+			return result, err
+		}
 	}
 
-	err = i.goModReplace(i.Replaces)
+	err = i.runModCommands(ctx)
 	if err != nil {
 		return result, err
 	}
 
-	if !i.KeepCgo {
-		adjustErr := i.adjustCgoTags()
-		if adjustErr != nil {
-			i.log("Failed to adjust base cgo tags, but this might not be an issue, depending on tags and environment. Cause: %v", adjustErr)
+	return result, err
+}
+
+// download runs go mod download for the requested usql module and returns the decoded output
+func (i Input) download(ctx context.Context) (map[string]any, error) {
+	var outputBuf bytes.Buffer
+	err := run.Command{
+		Dir:    i.WorkingDir,
+		GoBin:  run.FindGo(),
+		Args:   []string{"mod", "download", "-json", i.getUSQLModuleVersion()},
+		Stdout: &outputBuf,
+	}.Run(ctx)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 || outputBuf.Len() > 0 {
+			return nil, merry.Wrap(err, merry.AppendMessagef("stdout length %d", outputBuf.Len()))
 		}
+		// We ignore exit code 1 with non-empty output, because this indicates a partial success of
+		// go mod download command and that the package was likely successfully downloaded.
+		// This case happens frequently.
+		// https://github.com/golang/go/issues/35380 is about a different issue but some comments
+		// cover this case.
 	}
 
-	return result, err
+	var downloadInfo map[string]any
+	err = json.NewDecoder(&outputBuf).Decode(&downloadInfo)
+	return downloadInfo, merry.Wrap(err)
 }
 
 func (i Input) shouldReplaceMain() bool {
-	return i.Imports != nil || lo.IsNotEmpty(i.MainOpts)
+	return i.Imports != nil || len(i.Connectors) > 0 || i.MainTemplate != "" || i.hasSettings() || lo.IsNotEmpty(i.MainOpts)
 }
 
 func (i Input) getUSQLModuleVersion() string {
@@ -196,7 +345,7 @@ func (i Input) copyOriginalFromZip(downloadInfo map[string]any) error {
 func (i Input) copyOriginalFromDir(downloadInfo map[string]any) error {
 	errorMsg, ok := downloadInfo["Error"]
 	if ok {
-		return merry.Wrap(fmt.Errorf("failed to download module: %v", errorMsg))
+		return run.WrapFailure(fmt.Errorf("failed to download module: %v", errorMsg), fmt.Sprint(errorMsg))
 	}
 
 	downloadDirAny, ok := downloadInfo["Dir"]
@@ -213,26 +362,52 @@ func (i Input) copyOriginalFromDir(downloadInfo map[string]any) error {
 	return err
 }
 
-func (i Input) All() error {
-	_, err := i.AllDownload()
+func (i Input) All(ctx context.Context) error {
+	_, err := i.AllDownload(ctx)
 	return err
 }
 
-func (i Input) goModReplace(replaceList []string) error {
-	for _, rs := range replaceList {
+// goGetCommand returns the go get command that applies Gets to the generated module, if any
+func (i Input) goGetCommand() *PlannedCommand {
+	if len(i.Gets) == 0 {
+		return nil
+	}
+	// A single go get resolves all modules together, similar to a single go get with multiple arguments
+	// on the command-line.
+	return &PlannedCommand{Step: "go get", Args: append([]string{"get"}, i.Gets...)}
+}
+
+// tidyCommand returns the go mod tidy command, required after editing go.mod, if any
+func (i Input) tidyCommand() *PlannedCommand {
+	if i.NoTidy || len(i.goModEdits()) == 0 {
+		return nil
+	}
+	return &PlannedCommand{Step: "tidy", Args: []string{"mod", "tidy"}}
+}
 
-		// Consider golang.org/x/mod/modfile
-		err := i.runGoModReplace(rs)
+// runModCommands applies Gets, Replaces, Excludes, etc. to the generated module
+func (i Input) runModCommands(ctx context.Context) error {
+	if getCmd := i.goGetCommand(); getCmd != nil {
+		err := run.Step(getCmd.Step, func() error {
+			return i.runGo(ctx, getCmd.Args...)
+		})
 		if err != nil {
 			return err
 		}
-		// go doesn't support running two go mod edit -replace without a
-		// go mod tidy in between.
-		err = i.runGo("mod", "tidy")
+	}
+
+	if len(i.goModEdits()) > 0 {
+		err := run.Step("edit go.mod", i.editGoMod)
 		if err != nil {
 			return err
 		}
 	}
+
+	if tidyCmd := i.tidyCommand(); tidyCmd != nil {
+		return run.Step(tidyCmd.Step, func() error {
+			return i.runGo(ctx, tidyCmd.Args...)
+		})
+	}
 	return nil
 }
 
@@ -251,12 +426,8 @@ func (i Input) populateMain() error {
 	return merry.Wrap(mainFile.Close())
 }
 
-func (i Input) runGo(goCmd ...string) error {
-	return run.Go(i.WorkingDir, goCmd...)
-}
-
-func (i Input) runGoModReplace(replaceSpec string) error {
-	return i.runGo("mod", "edit", "-replace", replaceSpec)
+func (i Input) runGo(ctx context.Context, goCmd ...string) error {
+	return run.Go(ctx, i.WorkingDir, goCmd...)
 }
 
 func (i Input) populateDbMgr() error {
@@ -270,23 +441,20 @@ func (i Input) populateDbMgr() error {
 	return merry.Wrap(err)
 }
 
-func (i Input) doGoGet() error {
-	return doGoGet(i.Gets, i)
-}
+// pgoFile is the name of the profile, used by the go command for profile-guided optimization of the main package
+const pgoFile = "default.pgo"
 
-func (i Input) replaceInUsqlFile(relPath string, before string, after string) error {
-	origMainFile := filepath.Join(i.WorkingDir, relPath)
-	origMainBytes, err := os.ReadFile(origMainFile)
+func (i Input) copyProfile() error {
+	profile, err := os.ReadFile(i.PGOProfile)
 	if err != nil {
 		return merry.Wrap(err)
 	}
-	origMainBytes = bytes.Replace(origMainBytes, []byte(before), []byte(after), 1)
-	err = os.WriteFile(origMainFile, origMainBytes, fileMode)
+	err = os.WriteFile(filepath.Join(i.WorkingDir, pgoFile), profile, fileMode)
 	return merry.Wrap(err)
 }
 
-func (i Input) replaceMain() error {
-	err := i.replaceInUsqlFile("main.go", "func main()", "func origMain()")
+func (i Input) replaceMain(usqlVersion string) error {
+	err := i.applyUsqlPatch(mainPatch, usqlVersion)
 	if err != nil {
 		return err
 	}
@@ -294,28 +462,11 @@ func (i Input) replaceMain() error {
 	return i.populateMain()
 }
 
-func (i Input) adjustCgoTags() error {
-	err := i.replaceInUsqlFile(filepath.Join("internal", "sqlite3.go"), "!no_base", "!no_base && cgo")
-	if err != nil {
-		return err
-	}
-	moderncsqliteHookPath := filepath.Join("internal", "moderncsqlite.go")
-	// we must include moderncsqlite *only* if sqlite3 was excluded because of !cgo
-	return i.replaceInUsqlFile(moderncsqliteHookPath, "most", "most || (!cgo && !no_base && !no_sqlite3)")
-
-	// usql already contains code that assigns sqlite3 aliases to moderncsqlite,
-	// if moderncsqlite is present but sqlite3 is not - usql/internal/z.go
-}
-
-func (i Input) log(msg string, args ...any) {
-	_, _ = fmt.Fprintf(os.Stderr, msg, args...)
-}
-
-func doGoGet(gets []string, i Input) error {
-	for _, gs := range gets {
-		err := i.runGo("get", gs)
+func (i Input) adjustCgoTags(usqlVersion string) error {
+	for _, patch := range cgoTagPatches {
+		err := i.applyUsqlPatch(patch, usqlVersion)
 		if err != nil {
-			return err
+			return merry.Append(err, "use --db-option keepcgo to skip the cgo patches")
 		}
 	}
 	return nil
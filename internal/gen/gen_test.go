@@ -3,9 +3,13 @@ package gen_test
 import (
 	"bytes"
 	"fmt"
+	"go/parser"
+	"go/token"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/murfffi/gorich/fi"
@@ -23,6 +27,128 @@ func TestInput_Main(t *testing.T) {
 		require.NoError(t, inp.Main(&buf))
 		require.Contains(t, buf.String(), "hello/hello")
 	})
+	t.Run("with likes", func(t *testing.T) {
+		inp := gen.Input{
+			Imports: []string{"github.com/yugabyte/pgx/v5/stdlib"},
+			Likes:   []string{"pgx = postgres"},
+		}
+		buf := bytes.Buffer{}
+		require.NoError(t, inp.Main(&buf))
+		require.Contains(t, buf.String(), `"pgx": "postgres",`)
+	})
+	t.Run("with dialects", func(t *testing.T) {
+		inp := gen.Input{
+			Imports:  []string{"github.com/MonetDB/MonetDB-Go/v2"},
+			Dialects: []string{"monetdb:lexer=mysql,allow-hash-comments,batch=create procedure:end"},
+		}
+		buf := bytes.Buffer{}
+		require.NoError(t, inp.Main(&buf))
+		_, err := parser.ParseFile(token.NewFileSet(), "new_main.go", buf.Bytes(), 0)
+		require.NoError(t, err)
+		require.Contains(t, buf.String(), `LexerName:              "mysql",`)
+		require.Contains(t, buf.String(), `AllowHashComments:      true,`)
+		require.Contains(t, buf.String(), `"CREATE PROCEDURE": "END",`)
+	})
+	t.Run("with statement rules", func(t *testing.T) {
+		inp := gen.Input{
+			Imports:         []string{"github.com/microsoft/go-mssqldb"},
+			Rewrites:        []string{`mssql:/(?m)^\s*GO\s*$//`, "mssql:|LIMIT (\\d+)|TOP $1|"},
+			Classifications: []string{"mssql:query=^EXEC sp_help"},
+		}
+		buf := bytes.Buffer{}
+		require.NoError(t, inp.Main(&buf))
+		_, err := parser.ParseFile(token.NewFileSet(), "new_main.go", buf.Bytes(), 0)
+		require.NoError(t, err)
+		require.Contains(t, buf.String(), `{Pattern: "(?m)^\\s*GO\\s*$", Replacement: ""},`)
+		require.Contains(t, buf.String(), `{Pattern: "LIMIT (\\d+)", Replacement: "TOP $1"},`)
+		require.Contains(t, buf.String(), `{Pattern: "^EXEC sp_help", Query: true},`)
+	})
+	t.Run("with processors", func(t *testing.T) {
+		inp := gen.Input{
+			Imports:    []string{"github.com/microsoft/go-mssqldb"},
+			Processors: []string{"mssql:github.com/acme/tsql.Processor", "azuresql:github.com/acme/tsql.Processor"},
+		}
+		buf := bytes.Buffer{}
+		require.NoError(t, inp.Main(&buf))
+		_, err := parser.ParseFile(token.NewFileSet(), "new_main.go", buf.Bytes(), 0)
+		require.NoError(t, err)
+		require.Contains(t, buf.String(), `import processor0 "github.com/acme/tsql"`)
+		require.Contains(t, buf.String(), `"mssql": processor0.Processor,`)
+		require.Contains(t, buf.String(), `"azuresql": processor0.Processor,`)
+	})
+	t.Run("with connectors", func(t *testing.T) {
+		inp := gen.Input{
+			Connectors: []string{
+				"name=mysqlc,func=github.com/go-sql-driver/mysql.NewConnector,dsn=github.com/go-sql-driver/mysql.ParseDSN",
+				"name=acme,func=github.com/acme/db.NewConnector,noerr",
+			},
+		}
+		buf := bytes.Buffer{}
+		require.NoError(t, inp.Main(&buf))
+		_, err := parser.ParseFile(token.NewFileSet(), "new_main.go", buf.Bytes(), 0)
+		require.NoError(t, err)
+		require.Contains(t, buf.String(), `import connector1 "github.com/go-sql-driver/mysql"`)
+		require.Contains(t, buf.String(), `arg, err := connector1.ParseDSN(dsn)`)
+		require.Contains(t, buf.String(), `return connector1.NewConnector(arg)`)
+		require.Contains(t, buf.String(), `return connector0.NewConnector(arg), nil`)
+	})
+	t.Run("with version queries", func(t *testing.T) {
+		inp := gen.Input{
+			Imports:        []string{"github.com/MonetDB/MonetDB-Go/v2"},
+			VersionQueries: []string{"monetdb: SELECT value FROM sys.environment WHERE name = 'monet_version'"},
+		}
+		buf := bytes.Buffer{}
+		require.NoError(t, inp.Main(&buf))
+		_, err := parser.ParseFile(token.NewFileSet(), "new_main.go", buf.Bytes(), 0)
+		require.NoError(t, err)
+		require.Contains(t, buf.String(), `"monetdb": "SELECT value FROM sys.environment WHERE name = 'monet_version'",`)
+	})
+	t.Run("with defaults", func(t *testing.T) {
+		inp := gen.Input{
+			Imports:        []string{"github.com/MonetDB/MonetDB-Go/v2"},
+			Variables:      []string{"SYNTAX_HL_STYLE=monokai", "PROMPT1=%n@%M%R%# "},
+			PrintVariables: []string{"format=csv"},
+			EnvDefaults:    []string{"PAGER=less -S"},
+		}
+		require.NoError(t, inp.Validate())
+		buf := bytes.Buffer{}
+		require.NoError(t, inp.Main(&buf))
+		require.Contains(t, buf.String(), "\t\"os\"\n")
+		require.Contains(t, buf.String(), `env.Set("SYNTAX_HL_STYLE", "monokai")`)
+		require.Contains(t, buf.String(), `env.Pset("format", "csv")`)
+		require.Contains(t, buf.String(), `_ = os.Setenv("PAGER", "less -S")`)
+		// the default prompt of the distribution replaces the default prompt of usqlgen
+		require.Greater(t, strings.Index(buf.String(), `env.Set("PROMPT1", "%n@%M%R%# ")`), strings.Index(buf.String(), `env.Set("PROMPT1", "%S%N%m%R%# ")`))
+		require.Greater(t, strings.Index(buf.String(), "origMain()"), strings.Index(buf.String(), `env.Pset("format", "csv")`))
+	})
+	t.Run("with main template", func(t *testing.T) {
+		tplFile := filepath.Join(t.TempDir(), "main.tpl")
+		tpl := "package main\n\nvar likes = []string{ {{- range $driver, $builtin := .LikeDrivers}}{{quote $driver}},{{end -}} }\n" +
+			"var imports = {{quote (join .Imports \" \")}}\n\nfunc main() { origMain() }\n"
+		require.NoError(t, os.WriteFile(tplFile, []byte(tpl), 0600))
+		inp := gen.Input{
+			Imports:      []string{"github.com/yugabyte/pgx/v5/stdlib", "hello/hello"},
+			Likes:        []string{"pgx = postgres"},
+			MainTemplate: tplFile,
+		}
+		require.NoError(t, inp.Validate())
+		buf := bytes.Buffer{}
+		require.NoError(t, inp.Main(&buf))
+		require.Contains(t, buf.String(), `var likes = []string{"pgx",}`)
+		require.Contains(t, buf.String(), `var imports = "github.com/yugabyte/pgx/v5/stdlib hello/hello"`)
+	})
+	t.Run("with invalid main template", func(t *testing.T) {
+		tplFile := filepath.Join(t.TempDir(), "main.tpl")
+		require.NoError(t, os.WriteFile(tplFile, []byte("package main\n\nfunc main() { {{.Imports}}\n"), 0600))
+		inp := gen.Input{Imports: []string{"hello/hello"}, MainTemplate: tplFile}
+		require.NoError(t, inp.Validate())
+		buf := bytes.Buffer{}
+		require.ErrorContains(t, inp.Main(&buf), "didn't render valid new_main.go")
+		require.Empty(t, buf.String())
+
+		require.NoError(t, os.WriteFile(tplFile, []byte("package main\n{{.Imports"), 0600))
+		require.ErrorContains(t, inp.Validate(), "invalid --main-template")
+	})
 }
 
 func TestInput_All(t *testing.T) {
@@ -82,7 +208,7 @@ func runGenAll(t *testing.T, inp gen.Input, env []string) string {
 	tmpDir := t.TempDir()
 	inp.WorkingDir = tmpDir
 
-	err := inp.All()
+	err := inp.All(t.Context())
 	require.NoError(t, err)
 
 	env = append(os.Environ(), env...)
@@ -120,7 +246,7 @@ func TestInput_AllDownload(t *testing.T) {
 	var err error
 	tmpDir := t.TempDir()
 	inp.WorkingDir = tmpDir
-	result, err := inp.AllDownload()
+	result, err := inp.AllDownload(t.Context())
 	require.NoError(t, err)
 	entries, err := os.ReadDir(tmpDir)
 	require.NoError(t, err)
@@ -130,3 +256,159 @@ func TestInput_AllDownload(t *testing.T) {
 
 	require.Equal(t, inp.USQLVersion, result.DownloadedUsqlVersion)
 }
+
+func TestInput_Validate(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		inp := gen.Input{
+			Imports:   []string{"github.com/MonetDB/MonetDB-Go/v2"},
+			Replaces:  []string{"github.com/MonetDB/MonetDB-Go/v2=github.com/sclgo/MonetDB-Go/v2@fbbd00a"},
+			Excludes:  []string{"github.com/MonetDB/MonetDB-Go/v2@v2.0.0"},
+			Toolchain: "go1.23.4",
+		}
+		require.NoError(t, inp.Validate())
+	})
+
+	t.Run("bad replace", func(t *testing.T) {
+		inp := gen.Input{
+			Replaces: []string{"github.com/MonetDB/MonetDB-Go/v2"},
+		}
+		require.ErrorContains(t, inp.Validate(), "github.com/MonetDB/MonetDB-Go/v2")
+	})
+
+	invalidInputs := map[string]gen.Input{
+		`--import "github.com/foo bar"`:                      {Imports: []string{"github.com/foo bar"}},
+		`--get "github.com/foo/bar@"`:                        {Gets: []string{"github.com/foo/bar@"}},
+		`--replace "a=>b@v1"`:                                {Replaces: []string{"a=>b@v1"}},
+		`--replace "a=github.com/b"`:                         {Replaces: []string{"a=github.com/b"}},
+		`--replace "a=./missing"`:                            {Replaces: []string{"a=./missing"}},
+		`--usql-version "v1 2"`:                              {USQLVersion: "v1 2"},
+		`--exclude "example.com/a"`:                          {Excludes: []string{"example.com/a"}},
+		`--exclude "example.com/a@main"`:                     {Excludes: []string{"example.com/a@main"}},
+		`--toolchain "1.23"`:                                 {Toolchain: "1.23"},
+		`--main-template "missing.tpl"`:                      {MainTemplate: "missing.tpl"},
+		`--set "TIMING"`:                                     {Variables: []string{"TIMING"}},
+		`--set "1X=on"`:                                      {Variables: []string{"1X=on"}},
+		`--pset "Format=csv"`:                                {PrintVariables: []string{"Format=csv"}},
+		`--setenv "PAGER=more"`:                              {EnvDefaults: []string{"PAGER=less", "PAGER=more"}},
+		`--version-query "sqlite3"`:                          {Imports: []string{"modernc.org/sqlite"}, VersionQueries: []string{"sqlite3"}},
+		`--version-query`:                                    {VersionQueries: []string{"sqlite3:SELECT sqlite_version()"}},
+		`--rewrite "mssql:/GO/"`:                             {Rewrites: []string{"mssql:/GO/"}},
+		`--rewrite "mssql:/(GO//"`:                           {Rewrites: []string{"mssql:/(GO//"}},
+		`--classify "mssql:select=^EXEC"`:                    {Classifications: []string{"mssql:select=^EXEC"}},
+		`--classify`:                                         {Classifications: []string{"mssql:query=^EXEC"}},
+		`--processor "mssql:github.com/acme/tsql"`:           {Processors: []string{"mssql:github.com/acme/tsql"}},
+		`--processor "mssql:github.com/acme/tsql.processor"`: {Processors: []string{"mssql:github.com/acme/tsql.processor"}},
+		`--processor`:                                        {Processors: []string{"mssql:github.com/acme/tsql.Processor"}},
+		`--connector "name=acme"`:                            {Connectors: []string{"name=acme"}},
+		`--connector "name=a:b,func=github.com/acme/db.New"`: {Connectors: []string{"name=a:b,func=github.com/acme/db.New"}},
+		`--connector "name=acme,func=github.com/acme/db.New"`: {
+			Connectors: []string{"name=acme,func=github.com/acme/db.New", "name=acme,func=github.com/acme/db.New"},
+		},
+		`--replace "example.com/a=example.com/b@v1"`: {
+			Gets:     []string{"example.com/a@v2"},
+			Replaces: []string{"example.com/a=example.com/b@v1"},
+		},
+		`--replace "example.com/a=example.com/c@v1"`: {
+			Replaces: []string{"example.com/a=example.com/b@v1", "example.com/a=example.com/c@v1"},
+		},
+	}
+	for expected, inp := range invalidInputs {
+		t.Run(expected, func(t *testing.T) {
+			require.ErrorContains(t, inp.Validate(), expected)
+		})
+	}
+
+	t.Run("local replace", func(t *testing.T) {
+		localDir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(localDir, "go.mod"), []byte("module example.com/a\n"), 0600))
+		r, err := gen.ParseReplace("example.com/a@v1.0.0=" + localDir)
+		require.NoError(t, err)
+		require.True(t, r.IsLocal())
+		require.Equal(t, "v1.0.0", r.OldVersion)
+	})
+}
+
+func TestInput_DriverSettings(t *testing.T) {
+	inp := gen.Input{
+		Likes:          []string{" pgx = postgres ", "invalid"},
+		VersionQueries: []string{"sqlite3: SELECT sqlite_version() ", "invalid"},
+	}
+	require.Equal(t, map[string]string{"pgx": "postgres"}, inp.LikeDrivers())
+	require.Equal(t, map[string]string{"sqlite3": "SELECT sqlite_version()"}, inp.VersionQueriesByDriver())
+}
+
+func TestParseProcessor(t *testing.T) {
+	p, err := gen.ParseProcessor("mssql: gopkg.in/acme/tsql.v2.Processor")
+	require.NoError(t, err)
+	require.Equal(t, gen.Processor{Driver: "mssql", Package: "gopkg.in/acme/tsql.v2", Symbol: "Processor"}, p)
+}
+
+func TestParseConnector(t *testing.T) {
+	c, err := gen.ParseConnector("name=mysqlc, func=github.com/go-sql-driver/mysql.NewConnector, dsn=github.com/go-sql-driver/mysql.ParseDSN")
+	require.NoError(t, err)
+	require.Equal(t, gen.Connector{
+		Name:         "mysqlc",
+		Package:      "github.com/go-sql-driver/mysql",
+		Func:         "NewConnector",
+		ParsePackage: "github.com/go-sql-driver/mysql",
+		ParseFunc:    "ParseDSN",
+	}, c)
+
+	_, err = gen.ParseConnector("name=acme,func=github.com/acme/db.New,dsn=url")
+	require.Error(t, err)
+}
+
+func TestParseRewrite(t *testing.T) {
+	driver, rewrite, err := gen.ParseRewrite("mssql: |(?i)LIMIT (\\d+)|TOP $1|")
+	require.NoError(t, err)
+	require.Equal(t, "mssql", driver)
+	require.Equal(t, gen.Rewrite{Pattern: "(?i)LIMIT (\\d+)", Replacement: "TOP $1"}, rewrite)
+
+	_, rewrite, err = gen.ParseRewrite("mssql:/--.*$//")
+	require.NoError(t, err)
+	require.Empty(t, rewrite.Replacement)
+
+	_, _, err = gen.ParseRewrite("mssql:/a/b/c/")
+	require.Error(t, err)
+}
+
+func TestParseDialect(t *testing.T) {
+	driver, dialect, err := gen.ParseDialect("monetdb: lexer=postgres, allow-dollar, allow-c-comments, batch=BEGIN:END")
+	require.NoError(t, err)
+	require.Equal(t, "monetdb", driver)
+	require.Equal(t, gen.Dialect{
+		LexerName:          "postgres",
+		AllowDollar:        true,
+		AllowCComments:     true,
+		BatchQueryPrefixes: map[string]string{"BEGIN": "END"},
+	}, dialect)
+
+	_, _, err = gen.ParseDialect("monetdb:batch=BEGIN")
+	require.ErrorContains(t, err, "batch=prefix:end")
+}
+
+func TestPlannedCommand_String(t *testing.T) {
+	cmd := gen.PlannedCommand{
+		Env:  []string{"CGO_ENABLED=0"},
+		Args: []string{"build", "-ldflags", `-extldflags "-static"`, "."},
+	}
+	require.Equal(t, `CGO_ENABLED=0 go build -ldflags '-extldflags "-static"' .`, cmd.String())
+}
+
+func TestInput_Plan(t *testing.T) {
+	fi.SkipLongTest(t)
+	inp := gen.Input{
+		Imports:      []string{"github.com/MonetDB/MonetDB-Go/v2"},
+		Gets:         []string{"github.com/MonetDB/MonetDB-Go/v2@v2.0.1"},
+		USQLVersion:  "v0.19.14",
+		InitSnippets: []string{`fmt.Println("init")`},
+		Connectors:   []string{"name=acme,func=github.com/acme/db.New"},
+	}
+	plan, err := inp.Plan(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, "v0.19.14", plan.ResolvedVersion)
+	require.Contains(t, plan.GeneratedFiles, "new_main.go")
+	require.Equal(t, []string{"get", "github.com/MonetDB/MonetDB-Go/v2@v2.0.1"}, plan.GoGet.Args)
+	require.Equal(t, []string{`fmt.Println("init")`}, plan.InitSnippets)
+	require.Equal(t, []string{"acme: github.com/acme/db.New"}, plan.Connectors)
+}
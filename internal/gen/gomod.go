@@ -0,0 +1,102 @@
+package gen
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/ansel1/merry/v2"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// goModEdits returns the directives that editGoMod adds to go.mod, formatted as in go.mod
+func (i Input) goModEdits() []string {
+	var edits []string
+	for _, r := range i.parsedReplaces() {
+		edits = append(edits, "replace "+r.formatDirective())
+	}
+	for _, e := range i.parsedExcludes() {
+		edits = append(edits, "exclude "+e.Path+" "+e.Version)
+	}
+	if i.Toolchain != "" {
+		edits = append(edits, "toolchain "+i.Toolchain)
+	}
+	return edits
+}
+
+func (r Replace) formatDirective() string {
+	return joinDirectivePart(r.OldPath, r.OldVersion) + " => " + joinDirectivePart(r.NewPath, r.NewVersion)
+}
+
+func joinDirectivePart(path string, version string) string {
+	if version == "" {
+		return path
+	}
+	return path + " " + version
+}
+
+// parsedReplaces returns Replaces parsed with ParseReplace. It assumes that the Input was validated.
+func (i Input) parsedReplaces() []Replace {
+	var replaces []Replace
+	for _, rs := range i.Replaces {
+		r, err := ParseReplace(rs)
+		if err == nil {
+			replaces = append(replaces, r)
+		}
+	}
+	return replaces
+}
+
+// parsedExcludes returns Excludes parsed with parseExclude. It assumes that the Input was validated.
+func (i Input) parsedExcludes() []module.Version {
+	var excludes []module.Version
+	for _, es := range i.Excludes {
+		e, err := parseExclude(es)
+		if err == nil {
+			excludes = append(excludes, e)
+		}
+	}
+	return excludes
+}
+
+// editGoMod applies all Replaces, Excludes and the Toolchain to go.mod in one pass.
+// Unlike running go mod edit for each, editing doesn't require go mod tidy between edits.
+func (i Input) editGoMod() error {
+	goModPath := filepath.Join(i.WorkingDir, "go.mod")
+	data, err := os.ReadFile(goModPath)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	goMod, err := modfile.Parse(goModPath, data, nil)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+
+	for _, r := range i.parsedReplaces() {
+		err = goMod.AddReplace(r.OldPath, r.OldVersion, r.NewPath, r.NewVersion)
+		if err != nil {
+			return merry.Prependf(err, "failed to add replace %s", r)
+		}
+	}
+
+	for _, e := range i.parsedExcludes() {
+		err = goMod.AddExclude(e.Path, e.Version)
+		if err != nil {
+			return merry.Prependf(err, "failed to add exclude %s", e)
+		}
+	}
+
+	if i.Toolchain != "" {
+		err = goMod.AddToolchainStmt(i.Toolchain)
+		if err != nil {
+			return merry.Prependf(err, "failed to set toolchain %s", i.Toolchain)
+		}
+	}
+
+	goMod.Cleanup()
+	data, err = goMod.Format()
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	return merry.Wrap(os.WriteFile(goModPath, data, fileMode))
+}
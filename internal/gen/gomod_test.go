@@ -0,0 +1,41 @@
+package gen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInput_EditGoMod(t *testing.T) {
+	dir := t.TempDir()
+	goModPath := filepath.Join(dir, "go.mod")
+	goMod := "module github.com/xo/usql\n\ngo 1.23\n\nrequire github.com/go-sql-driver/mysql v1.8.1\n"
+	require.NoError(t, os.WriteFile(goModPath, []byte(goMod), fileMode))
+
+	inp := Input{
+		WorkingDir: dir,
+		Replaces: []string{
+			"github.com/go-sql-driver/mysql=github.com/go-sql-driver/mysql@v1.7.1",
+			"github.com/microsoft/go-mssqldb@v1.0.0=github.com/dlapko/go-mssqldb@v1.1.0",
+		},
+		Excludes:  []string{"github.com/go-sql-driver/mysql@v1.8.0"},
+		Toolchain: "go1.23.4",
+	}
+	require.Equal(t, []string{
+		"replace github.com/go-sql-driver/mysql => github.com/go-sql-driver/mysql v1.7.1",
+		"replace github.com/microsoft/go-mssqldb v1.0.0 => github.com/dlapko/go-mssqldb v1.1.0",
+		"exclude github.com/go-sql-driver/mysql v1.8.0",
+		"toolchain go1.23.4",
+	}, inp.goModEdits())
+	require.NoError(t, inp.editGoMod())
+
+	edited, err := os.ReadFile(goModPath)
+	require.NoError(t, err)
+	require.Contains(t, string(edited), "require github.com/go-sql-driver/mysql v1.8.1\n")
+	require.Contains(t, string(edited), "github.com/go-sql-driver/mysql => github.com/go-sql-driver/mysql v1.7.1\n")
+	require.Contains(t, string(edited), "github.com/microsoft/go-mssqldb v1.0.0 => github.com/dlapko/go-mssqldb v1.1.0\n")
+	require.Contains(t, string(edited), "exclude github.com/go-sql-driver/mysql v1.8.0\n")
+	require.Contains(t, string(edited), "toolchain go1.23.4\n")
+}
@@ -0,0 +1,219 @@
+package gen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ansel1/merry/v2"
+	"github.com/sclgo/usqlgen/internal/run"
+	"golang.org/x/mod/modfile"
+)
+
+// initSnippetsFile is the file in the main package that runs InitSnippets
+const initSnippetsFile = "usqlgen_init.go"
+
+// initFileNames returns the names of InitFiles in the main package. Files are prefixed with their index,
+// so files with the same name in different directories don't clash.
+func (i Input) initFileNames() []string {
+	names := make([]string, len(i.InitFiles))
+	for idx, file := range i.InitFiles {
+		names[idx] = fmt.Sprintf("usqlgen_init_%d_%s", idx, filepath.Base(file))
+	}
+	return names
+}
+
+// validateInitFile checks that file is a Go source file in package main
+func validateInitFile(file string) error {
+	parsed, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.PackageClauseOnly)
+	if err != nil {
+		return merry.Prependf(err, "invalid --init-file %q", file)
+	}
+	if parsed.Name.Name != "main" || filepath.Ext(file) != ".go" {
+		return merry.Errorf("invalid --init-file %q: must be a .go file in package main", file)
+	}
+	return nil
+}
+
+// initSnippetsSource returns a Go file without imports, in which each snippet is the body of an init function
+func initSnippetsSource(snippets []string) string {
+	var sb strings.Builder
+	sb.WriteString("// Code generated by usqlgen from --init. DO NOT EDIT.\n\npackage main\n")
+	for _, snippet := range snippets {
+		_, _ = fmt.Fprintf(&sb, "\nfunc init() {\n%s\n}\n", snippet)
+	}
+	return sb.String()
+}
+
+// parseInitSnippets parses the snippets and returns the package names that they refer to
+func parseInitSnippets(snippets []string) ([]string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, initSnippetsFile, initSnippetsSource(snippets), 0)
+	if err != nil {
+		return nil, merry.Prependf(err, "invalid --init")
+	}
+
+	// Type-checking resolves all identifiers except the package names, since the file has no imports.
+	// Other errors are expected e.g. for uses of the packages, so they are ignored.
+	info := &types.Info{Defs: make(map[*ast.Ident]types.Object), Uses: make(map[*ast.Ident]types.Object)}
+	conf := types.Config{Error: func(error) {}}
+	_, _ = conf.Check("main", fset, []*ast.File{file}, info)
+
+	var names []string
+	ast.Inspect(file, func(node ast.Node) bool {
+		if selector, ok := node.(*ast.SelectorExpr); ok {
+			if ident, ok := selector.X.(*ast.Ident); ok && info.Uses[ident] == nil && info.Defs[ident] == nil {
+				names = append(names, ident.Name)
+			}
+		}
+		return true
+	})
+	slices.Sort(names)
+	return slices.Compact(names), nil
+}
+
+// assumedPackageName returns the likely name of the package with the given import path,
+// similar to goimports e.g. mysql for github.com/go-sql-driver/mysql and yaml for gopkg.in/yaml.v3
+func assumedPackageName(importPath string) string {
+	base := path.Base(importPath)
+	if strings.HasPrefix(base, "v") {
+		if _, err := strconv.Atoi(base[1:]); err == nil && path.Dir(importPath) != "." {
+			base = path.Base(path.Dir(importPath))
+		}
+	}
+	base = strings.ToLower(base)
+	base = strings.TrimPrefix(base, "go-")
+	base = strings.TrimSuffix(strings.TrimSuffix(base, "-go"), ".go")
+	if idx := strings.IndexFunc(base, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}); idx >= 0 {
+		base = base[:idx]
+	}
+	return base
+}
+
+// resolveInitImports finds the import path for each package name. Candidates are tried in order and
+// each candidate is a list of import paths, that are equally likely.
+func resolveInitImports(names []string, candidates ...[]string) (map[string]string, error) {
+	imports := make(map[string]string, len(names))
+	for _, name := range names {
+		for _, paths := range candidates {
+			var matches []string
+			for _, p := range paths {
+				if assumedPackageName(p) == name && !slices.Contains(matches, p) {
+					matches = append(matches, p)
+				}
+			}
+			if len(matches) > 1 {
+				return nil, merry.Errorf("package %s in --init is ambiguous: it may be any of %s; use --init-file with explicit imports instead",
+					name, strings.Join(matches, ", "))
+			}
+			if len(matches) == 1 {
+				imports[name] = matches[0]
+				break
+			}
+		}
+		if _, ok := imports[name]; !ok {
+			return nil, merry.Errorf("package %s in --init is not the standard library, --import or a usql dependency; use --init-file with explicit imports instead", name)
+		}
+	}
+	return imports, nil
+}
+
+// listStd lists the importable standard library packages
+func listStd(ctx context.Context, workingDir string) ([]string, error) {
+	var output bytes.Buffer
+	err := run.Command{
+		Dir:    workingDir,
+		GoBin:  run.FindGo(),
+		Args:   []string{"list", "std"},
+		Stdout: &output,
+	}.Run(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(strings.Fields(output.String()), func(p string) bool {
+		elems := strings.Split(p, "/")
+		return slices.Contains(elems, "internal") || slices.Contains(elems, "vendor")
+	}), nil
+}
+
+// requiredModules lists the modules required by the go.mod in workingDir
+func requiredModules(workingDir string) ([]string, error) {
+	goModPath := filepath.Join(workingDir, "go.mod")
+	data, err := os.ReadFile(goModPath)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	goMod, err := modfile.Parse(goModPath, data, nil)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	modules := make([]string, len(goMod.Require))
+	for idx, req := range goMod.Require {
+		modules[idx] = req.Mod.Path
+	}
+	return modules, nil
+}
+
+// populateInit adds InitFiles and InitSnippets to the main package. Imports of snippets are resolved from
+// --import, the standard library and the modules that usql requires, in this order.
+func (i Input) populateInit(ctx context.Context) error {
+	for idx, name := range i.initFileNames() {
+		content, err := os.ReadFile(i.InitFiles[idx])
+		if err != nil {
+			return merry.Wrap(err)
+		}
+		err = os.WriteFile(filepath.Join(i.WorkingDir, name), content, fileMode)
+		if err != nil {
+			return merry.Wrap(err)
+		}
+	}
+	if len(i.InitSnippets) == 0 {
+		return nil
+	}
+
+	names, err := parseInitSnippets(i.InitSnippets)
+	if err != nil {
+		return err
+	}
+	std, err := listStd(ctx, i.WorkingDir)
+	if err != nil {
+		return err
+	}
+	required, err := requiredModules(i.WorkingDir)
+	if err != nil {
+		return err
+	}
+	imports, err := resolveInitImports(names, i.Imports, std, required)
+	if err != nil {
+		return err
+	}
+
+	source := initSnippetsSource(i.InitSnippets)
+	var importDecl strings.Builder
+	importDecl.WriteString("\nimport (\n")
+	for _, name := range names {
+		_, _ = fmt.Fprintf(&importDecl, "\t%s %q\n", name, imports[name])
+	}
+	importDecl.WriteString(")\n")
+	source = strings.Replace(source, "package main\n", "package main\n"+importDecl.String(), 1)
+	formatted, err := format.Source([]byte(source))
+	if err != nil {
+		return merry.Prependf(err, "invalid --init")
+	}
+	err = os.WriteFile(filepath.Join(i.WorkingDir, initSnippetsFile), formatted, fileMode)
+	return merry.Wrap(err)
+}
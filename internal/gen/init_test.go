@@ -0,0 +1,60 @@
+package gen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInput_PopulateInit(t *testing.T) {
+	dir := t.TempDir()
+	goMod := "module github.com/xo/usql\n\ngo 1.23\n\nrequire github.com/go-sql-driver/mysql v1.8.1\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), fileMode))
+	initFile := filepath.Join(t.TempDir(), "tls.go")
+	require.NoError(t, os.WriteFile(initFile, []byte("package main\n\nfunc init() {}\n"), fileMode))
+
+	inp := Input{
+		WorkingDir: dir,
+		Imports:    []string{"github.com/MonetDB/MonetDB-Go/v2"},
+		InitFiles:  []string{initFile},
+		InitSnippets: []string{
+			`cfg := &tls.Config{ServerName: "db"}
+			_ = mysql.RegisterTLSConfig("custom", cfg)`,
+			`_ = monetdb.Version`,
+		},
+	}
+	require.NoError(t, inp.Validate())
+	require.NoError(t, inp.populateInit(t.Context()))
+
+	require.FileExists(t, filepath.Join(dir, "usqlgen_init_0_tls.go"))
+	generated, err := os.ReadFile(filepath.Join(dir, initSnippetsFile))
+	require.NoError(t, err)
+	require.Contains(t, string(generated), `mysql "github.com/go-sql-driver/mysql"`)
+	require.Contains(t, string(generated), `monetdb "github.com/MonetDB/MonetDB-Go/v2"`)
+	require.Contains(t, string(generated), `tls "crypto/tls"`)
+	require.NotContains(t, string(generated), `cfg "`)
+
+	inp.InitSnippets = []string{`_ = rand.Int()`}
+	require.ErrorContains(t, inp.populateInit(t.Context()), "math/rand")
+	inp.InitSnippets = []string{`unknown.Call()`}
+	require.ErrorContains(t, inp.populateInit(t.Context()), "package unknown")
+}
+
+func TestValidateInit(t *testing.T) {
+	_, err := parseInitSnippets([]string{"mysql.RegisterTLSConfig("})
+	require.ErrorContains(t, err, "invalid --init")
+
+	initFile := filepath.Join(t.TempDir(), "tls.go")
+	require.NoError(t, os.WriteFile(initFile, []byte("package tls\n"), fileMode))
+	require.ErrorContains(t, validateInitFile(initFile), "package main")
+}
+
+func TestAssumedPackageName(t *testing.T) {
+	require.Equal(t, "mysql", assumedPackageName("github.com/go-sql-driver/mysql"))
+	require.Equal(t, "sqlite3", assumedPackageName("github.com/mattn/go-sqlite3"))
+	require.Equal(t, "monetdb", assumedPackageName("github.com/MonetDB/MonetDB-Go/v2"))
+	require.Equal(t, "yaml", assumedPackageName("gopkg.in/yaml.v3"))
+	require.Equal(t, "rand", assumedPackageName("math/rand/v2"))
+}
@@ -9,6 +9,7 @@ const mainTpl = `
 package main
 
 import (
+	"context"
 	"maps"
 	"slices"
 	"fmt"
@@ -23,11 +24,47 @@ import (
 	{{if .MainOpts.PprofWeb}}
 	_ "net/http/pprof"
 	{{end}}
+	{{if .EnvDefaults}}
+	"os"
+	{{end}}
 )
 
 {{range $val := .Imports}}
 import _ "{{$val}}"
 {{end}}
+{{range $alias, $pkg := .ProcessorImports}}
+import {{$alias}} "{{$pkg}}"
+{{end}}
+{{if .Connectors}}
+import (
+	"database/sql"
+	"database/sql/driver"
+)
+{{range $alias, $pkg := .ConnectorImports}}
+import {{$alias}} "{{$pkg}}"
+{{end}}
+
+// Connector-only libraries are registered as database/sql drivers, so they are found like other new drivers.
+func init() {
+{{- range .ConnectorsByName}}
+	sql.Register({{printf "%q" .Name}}, gen.ConnectorDriver{NewConnector: func(dsn string) (driver.Connector, error) {
+	{{- if .ParseFunc}}
+		arg, err := {{.ParseAlias}}.{{.ParseFunc}}(dsn)
+		if err != nil {
+			return nil, err
+		}
+	{{- else}}
+		arg := dsn
+	{{- end}}
+	{{- if .NoErr}}
+		return {{.Alias}}.{{.Func}}(arg), nil
+	{{- else}}
+		return {{.Alias}}.{{.Func}}(arg)
+	{{- end}}
+	}})
+{{- end}}
+}
+{{end}}
 
 func NewReader(db drivers.DB, opts ...metadata.ReaderOption) metadata.Reader {
 	newIS := infos.New(
@@ -49,15 +86,93 @@ func NewReader(db drivers.DB, opts ...metadata.ReaderOption) metadata.Reader {
 	return is
 }
 
+// likeDrivers maps new drivers to the built-in drivers, whose configuration they reuse
+var likeDrivers = map[string]string{
+{{- range $driver, $builtin := .LikeDrivers}}
+	{{printf "%q" $driver}}: {{printf "%q" $builtin}},
+{{- end}}
+}
+
+// dialects configures how usql highlights and splits SQL for new drivers
+var dialects = map[string]drivers.Driver{
+{{- range $driver, $dialect := .DialectsByDriver}}
+	{{printf "%q" $driver}}: {
+		LexerName:              {{printf "%q" $dialect.LexerName}},
+		AllowDollar:            {{$dialect.AllowDollar}},
+		AllowMultilineComments: {{$dialect.AllowMultilineComments}},
+		AllowCComments:         {{$dialect.AllowCComments}},
+		AllowHashComments:      {{$dialect.AllowHashComments}},
+		BatchQueryPrefixes: map[string]string{
+		{{- range $prefix, $end := $dialect.BatchQueryPrefixes}}
+			{{printf "%q" $prefix}}: {{printf "%q" $end}},
+		{{- end}}
+		},
+	},
+{{- end}}
+}
+
+// versionQueries return the server version of new drivers. Other new drivers use gen.VersionProbe.
+var versionQueries = map[string]string{
+{{- range $driver, $query := .VersionQueriesByDriver}}
+	{{printf "%q" $driver}}: {{printf "%q" $query}},
+{{- end}}
+}
+
+// processors preprocess statements of new drivers. Statements they don't handle get the default processing.
+var processors = map[string]gen.StatementProcessor{
+{{- range $driver, $processor := .ProcessorsByDriver}}
+	{{printf "%q" $driver}}: {{$processor.Alias}}.{{$processor.Symbol}},
+{{- end}}
+}
+
+// statementRules rewrite and classify statements of new drivers
+var statementRules = map[string]gen.StatementRules{
+{{- range $driver, $rules := .StatementRulesByDriver}}
+	{{printf "%q" $driver}}: {
+		Rewrites: []gen.Rewrite{
+		{{- range $rules.Rewrites}}
+			{Pattern: {{printf "%q" .Pattern}}, Replacement: {{printf "%q" .Replacement}}},
+		{{- end}}
+		},
+		Classifications: []gen.Classification{
+		{{- range $rules.Classifications}}
+			{Pattern: {{printf "%q" .Pattern}}, Query: {{.Query}}},
+		{{- end}}
+		},
+	},
+{{- end}}
+}
+
+// withDialect overrides the configuration of a driver with the settings of a dialect that are set
+func withDialect(config drivers.Driver, dialect drivers.Driver) drivers.Driver {
+	if dialect.LexerName != "" {
+		config.LexerName = dialect.LexerName
+	}
+	config.AllowDollar = config.AllowDollar || dialect.AllowDollar
+	config.AllowMultilineComments = config.AllowMultilineComments || dialect.AllowMultilineComments
+	config.AllowCComments = config.AllowCComments || dialect.AllowCComments
+	config.AllowHashComments = config.AllowHashComments || dialect.AllowHashComments
+	if len(dialect.BatchQueryPrefixes) > 0 {
+		config.BatchQueryPrefixes = dialect.BatchQueryPrefixes
+	}
+	return config
+}
+
 func main() {
-	newDrivers := gen.RegisterNewDrivers(slices.Collect(maps.Keys(drivers.Available())))
+	available := drivers.Available()
+	newDrivers := gen.RegisterNewDrivers(slices.Collect(maps.Keys(available)))
 	if len(newDrivers) == 0 && {{len .Imports}} > 0 {
 		fmt.Println("Did not find new drivers in packages {{ .Imports }}. " +
 			"Either the packages don't register drivers or an imported driver name clashes with existing drivers or their aliases. " +
 			"In the latter case, try adding '-- -tags no_xxx' to the usqlgen command-line, where xxx is a DB tag from usql docs.")
 	}
+	for driver, builtin := range likeDrivers {
+		if !slices.Contains(newDrivers, driver) {
+			fmt.Printf("Driver %s, configured like %s, was not registered by the imported packages.\n", driver, builtin)
+		}
+	}
 	for _, driver := range newDrivers {
-		drivers.Register(driver, drivers.Driver{
+		config := drivers.Driver{
 			Copy: gen.BuildSimpleCopy(gen.FixedPlaceholder("?")),
 			NewMetadataReader: NewReader,
 			{{if not .IncludeSemicolon}}
@@ -67,10 +182,55 @@ func main() {
 				return typ, sqlstr, q, nil
 			},
 			{{end}}
-		})
+		}
+		if builtin, ok := likeDrivers[driver]; ok {
+			if builtinDriver, ok := available[builtin]; ok {
+				// Open opens connections with the database/sql driver of the built-in driver.
+				// Without it, usql opens connections with the new driver.
+				builtinDriver.Open = nil
+				config = builtinDriver
+			} else {
+				fmt.Printf("Driver %s can't be configured like %s, because %s is not included in this usql build.\n", driver, builtin, builtin)
+			}
+		}
+		if dialect, ok := dialects[driver]; ok {
+			config = withDialect(config, dialect)
+		}
+		if processor, ok := processors[driver]; ok {
+			config.Process = gen.ProcessWith(processor, config.Process, drivers.QueryExecType)
+		}
+		if rules, ok := statementRules[driver]; ok {
+			config.Process = rules.Wrap(config.Process, drivers.QueryExecType)
+		}
+		if query, ok := versionQueries[driver]; ok || config.Version == nil {
+			probe := gen.NewVersionProbe(query)
+			config.Version = func(ctx context.Context, db drivers.DB) (string, error) {
+				return probe.Version(ctx, db)
+			}
+		}
+		drivers.Register(driver, config)
 	}
 	// The default prompt is sometimes too long for DBs with opaque URLs
 	env.Set("PROMPT1", "%S%N%m%R%# ")
+{{- if or .Variables .PrintVariables .EnvDefaults}}
+	// Defaults of this distribution. usqlrc files and the usql command-line are applied later by origMain,
+	// so they override the defaults.
+{{- end}}
+{{- range $name, $value := .EnvDefaultsByName}}
+	if _, ok := os.LookupEnv({{printf "%q" $name}}); !ok {
+		_ = os.Setenv({{printf "%q" $name}}, {{printf "%q" $value}})
+	}
+{{- end}}
+{{- range $name, $value := .VariablesByName}}
+	if err := env.Set({{printf "%q" $name}}, {{printf "%q" $value}}); err != nil {
+		fmt.Printf("Default of variable %s is invalid: %v\n", {{printf "%q" $name}}, err)
+	}
+{{- end}}
+{{- range $name, $value := .PrintVariablesByName}}
+	if _, err := env.Pset({{printf "%q" $name}}, {{printf "%q" $value}}); err != nil {
+		fmt.Printf("Default of print option %s is invalid: %v\n", {{printf "%q" $name}}, err)
+	}
+{{- end}}
 
 	{{if .MainOpts.PprofWeb}}
 	gen.StartPprofServer()
@@ -0,0 +1,65 @@
+package gen
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/ansel1/merry/v2"
+)
+
+// mainFuncs are the functions available to main templates, in addition to the text/template builtins
+var mainFuncs = template.FuncMap{
+	// quote returns a Go string literal
+	"quote": strconv.Quote,
+	"join":  strings.Join,
+}
+
+// DefaultMainTemplate returns the template of new_main.go, used unless --main-template is given
+func DefaultMainTemplate() string {
+	return mainTpl
+}
+
+// mainTemplate parses MainTemplate, if set, or the default template
+func (i Input) mainTemplate() (*template.Template, error) {
+	if i.MainTemplate == "" {
+		return template.Must(template.New("main").Funcs(mainFuncs).Parse(mainTpl)), nil
+	}
+	text, err := os.ReadFile(i.MainTemplate)
+	if err != nil {
+		return nil, merry.Prependf(err, "invalid --main-template %q", i.MainTemplate)
+	}
+	tpl, err := template.New(filepath.Base(i.MainTemplate)).Funcs(mainFuncs).Parse(string(text))
+	if err != nil {
+		return nil, merry.Prependf(err, "invalid --main-template %q", i.MainTemplate)
+	}
+	return tpl, nil
+}
+
+// Main renders new_main.go to w. The template is executed with the Input, so templates can use its fields
+// and the methods that resolve driver settings e.g. LikeDrivers. The output is written only if it is valid Go.
+func (i Input) Main(w io.Writer) error {
+	tpl, err := i.mainTemplate()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	err = tpl.Execute(&buf, i)
+	if err == nil {
+		_, err = parser.ParseFile(token.NewFileSet(), "new_main.go", buf.Bytes(), parser.SkipObjectResolution)
+	}
+	if err != nil {
+		if i.MainTemplate != "" {
+			return merry.Prependf(err, "--main-template %q didn't render valid new_main.go", i.MainTemplate)
+		}
+		return merry.Wrap(err)
+	}
+	_, err = w.Write(buf.Bytes())
+	return merry.Wrap(err)
+}
@@ -0,0 +1,433 @@
+package gen
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ansel1/merry/v2"
+	"github.com/murfffi/gorich/lang"
+)
+
+// devNull is the path of the missing side of a diff of an added or deleted file
+const devNull = "/dev/null"
+
+// hunkWindow is how many lines away from the line in its header a hunk may apply
+const hunkWindow = 20
+
+var hunkHeaderRE = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// unsupportedGitHeaders are the extended headers of git diff for changes that a unified diff can't describe
+var unsupportedGitHeaders = []struct {
+	prefix string
+	reason string
+}{
+	{"rename from ", "renames are not supported; use git diff --no-renames"},
+	{"rename to ", "renames are not supported; use git diff --no-renames"},
+	{"copy from ", "copies are not supported; use git diff --no-renames"},
+	{"copy to ", "copies are not supported; use git diff --no-renames"},
+	{"old mode ", "file mode changes are not supported"},
+	{"new mode ", "file mode changes are not supported"},
+	{"Binary files ", "binary changes are not supported"},
+	{"GIT binary patch", "binary changes are not supported"},
+}
+
+// filePatch is the diff of one file in a unified diff
+type filePatch struct {
+	// OldPath and NewPath are relative to the usql module root. One of them is empty for added
+	// or deleted files.
+	OldPath string
+	NewPath string
+	Hunks   []hunk
+}
+
+// hunk is a change to consecutive lines of a file
+type hunk struct {
+	Header   string
+	OldStart int
+	OldLines []string
+	NewLines []string
+	// NewNoEOL is true if the last line of NewLines is also the last line of the file and doesn't end with a newline
+	NewNoEOL bool
+}
+
+// parseUnifiedDiff parses a unified diff, as produced by diff -u or git diff. Paths, prefixed with a/ and b/,
+// as in git diff, are stripped of the prefix.
+func parseUnifiedDiff(data []byte) ([]filePatch, error) {
+	var patches []filePatch
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 16*1024*1024)
+	lineNo := 0
+	next := func() (string, bool) {
+		if !scanner.Scan() {
+			return "", false
+		}
+		lineNo++
+		return scanner.Text(), true
+	}
+
+	line, ok := next()
+	for ok {
+		if !strings.HasPrefix(line, "--- ") {
+			// headers like diff --git and index, or text before the diff
+			for _, header := range unsupportedGitHeaders {
+				if strings.HasPrefix(line, header.prefix) {
+					return nil, merry.Errorf("line %d: %q: %s", lineNo, line, header.reason)
+				}
+			}
+			line, ok = next()
+			continue
+		}
+		oldPath := diffPath(line, "--- ", "a/")
+		line, ok = next()
+		if !ok || !strings.HasPrefix(line, "+++ ") {
+			return nil, merry.Errorf("line %d: expected +++ after ---", lineNo)
+		}
+		patch := filePatch{OldPath: oldPath, NewPath: diffPath(line, "+++ ", "b/")}
+		if patch.OldPath == "" && patch.NewPath == "" {
+			return nil, merry.Errorf("line %d: both sides of the diff are %s", lineNo, devNull)
+		}
+
+		line, ok = next()
+		for ok && strings.HasPrefix(line, "@@") {
+			var h hunk
+			var err error
+			h, line, ok, err = parseHunk(line, next)
+			if err != nil {
+				return nil, merry.Prependf(err, "line %d", lineNo)
+			}
+			patch.Hunks = append(patch.Hunks, h)
+		}
+		patches = append(patches, patch)
+	}
+	if len(patches) == 0 {
+		return nil, merry.New("no file changes found; expected a unified diff")
+	}
+	return patches, merry.Wrap(scanner.Err())
+}
+
+// parseHunk parses the hunk, starting with the given header line. It returns the hunk and the line after it.
+func parseHunk(header string, next func() (string, bool)) (hunk, string, bool, error) {
+	h := hunk{Header: header}
+	match := hunkHeaderRE.FindStringSubmatch(header)
+	if match == nil {
+		return h, "", false, merry.Errorf("invalid hunk header %q", header)
+	}
+	h.OldStart, _ = strconv.Atoi(match[1])
+	oldCount, newCount := hunkCount(match[2]), hunkCount(match[4])
+
+	line, ok := next()
+	lastSide := byte(0)
+	for ok && (len(h.OldLines) < oldCount || len(h.NewLines) < newCount || strings.HasPrefix(line, `\`)) {
+		if line == "" {
+			// some editors strip the trailing space of empty context lines
+			line = " "
+		}
+		switch line[0] {
+		case ' ':
+			h.OldLines = append(h.OldLines, line[1:])
+			h.NewLines = append(h.NewLines, line[1:])
+		case '-':
+			h.OldLines = append(h.OldLines, line[1:])
+		case '+':
+			h.NewLines = append(h.NewLines, line[1:])
+		case '\\':
+			// \ No newline at end of file applies to the preceding line
+			if lastSide == ' ' || lastSide == '+' {
+				h.NewNoEOL = true
+			}
+		default:
+			return h, line, ok, merry.Errorf("unexpected line %q in hunk %s", line, header)
+		}
+		lastSide = line[0]
+		line, ok = next()
+	}
+	if len(h.OldLines) != oldCount || len(h.NewLines) != newCount {
+		return h, line, ok, merry.Errorf("hunk %s is truncated", header)
+	}
+	return h, line, ok, nil
+}
+
+func hunkCount(s string) int {
+	if s == "" {
+		return 1
+	}
+	count, _ := strconv.Atoi(s)
+	return count
+}
+
+// diffPath returns the path in a --- or +++ line, without timestamps and the given git prefix,
+// or an empty string for /dev/null
+func diffPath(line string, marker string, gitPrefix string) string {
+	path, _, _ := strings.Cut(strings.TrimPrefix(line, marker), "\t")
+	path = strings.TrimSpace(path)
+	if path == devNull {
+		return ""
+	}
+	return strings.TrimPrefix(path, gitPrefix)
+}
+
+// splitLines splits content into lines and reports whether the last line ends with a newline
+func splitLines(content []byte) ([]string, bool) {
+	if len(content) == 0 {
+		return nil, true
+	}
+	lines := strings.Split(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1], true
+	}
+	return lines, false
+}
+
+func joinLines(lines []string, eol bool) []byte {
+	if len(lines) == 0 {
+		return nil
+	}
+	content := strings.Join(lines, "\n")
+	if eol {
+		content += "\n"
+	}
+	return []byte(content)
+}
+
+// applyHunks applies the hunks to lines in order. A hunk applies at the line in its header, adjusted by the changes
+// of previous hunks, or at most hunkWindow lines away, after the previous hunk, where all its old lines match.
+// Hunks that don't apply, or match at more than one position, are reported as conflicts.
+func applyHunks(lines []string, eol bool, hunks []hunk) ([]string, bool, []string) {
+	var conflicts []string
+	offset := 0
+	minPos := 0
+	for idx, h := range hunks {
+		expected := h.OldStart - 1 + offset
+		if len(h.OldLines) == 0 {
+			// pure additions are inserted after line OldStart
+			expected = h.OldStart + offset
+		}
+		positions := findHunk(lines, h.OldLines, expected, minPos)
+		if len(positions) != 1 {
+			conflict := describeMismatch(lines, h.OldLines, expected, minPos)
+			if len(positions) > 1 {
+				conflict = fmt.Sprintf("the context matches at lines %s; add context lines to the hunk", positionList(positions))
+			}
+			conflicts = append(conflicts, fmt.Sprintf("hunk #%d %s: %s", idx+1, h.Header, conflict))
+			continue
+		}
+		pos := positions[0]
+		end := pos + len(h.OldLines)
+		if end == len(lines) && len(h.NewLines) > 0 {
+			eol = !h.NewNoEOL
+		}
+		lines = append(lines[:pos:pos], append(append([]string(nil), h.NewLines...), lines[end:]...)...)
+		offset += pos - expected + len(h.NewLines) - len(h.OldLines)
+		minPos = pos + len(h.NewLines)
+	}
+	return lines, eol, conflicts
+}
+
+// findHunk returns the positions where lines contain old, at most hunkWindow lines away from expected and
+// not before minPos, nearest first. A hunk without old lines matches only at expected.
+func findHunk(lines []string, old []string, expected int, minPos int) []int {
+	matches := func(pos int) bool {
+		if pos < minPos || pos+len(old) > len(lines) {
+			return false
+		}
+		for idx, line := range old {
+			if lines[pos+idx] != line {
+				return false
+			}
+		}
+		return true
+	}
+	if len(old) == 0 {
+		if matches(expected) {
+			return []int{expected}
+		}
+		return nil
+	}
+	var positions []int
+	for delta := 0; delta <= hunkWindow; delta++ {
+		if matches(expected - delta) {
+			positions = append(positions, expected-delta)
+		}
+		if delta > 0 && matches(expected+delta) {
+			positions = append(positions, expected+delta)
+		}
+	}
+	return positions
+}
+
+// positionList formats positions as 1-based line numbers
+func positionList(positions []int) string {
+	numbers := make([]string, len(positions))
+	for idx, pos := range positions {
+		numbers[idx] = strconv.Itoa(pos + 1)
+	}
+	return strings.Join(numbers, ", ")
+}
+
+// describeMismatch describes the first old line that is different in lines, starting at the nearest position
+// to expected where the first old line matches, if any
+func describeMismatch(lines []string, old []string, expected int, minPos int) string {
+	if len(old) > 0 {
+		if positions := findHunk(lines, old[:1], expected, minPos); len(positions) > 0 {
+			expected = positions[0]
+		}
+	}
+	for idx, line := range old {
+		pos := expected + idx
+		if pos < 0 || pos >= len(lines) {
+			return fmt.Sprintf("expected %q at line %d, but the file has %d lines", line, pos+1, len(lines))
+		}
+		if lines[pos] != line {
+			return fmt.Sprintf("expected %q at line %d, found %q", line, pos+1, lines[pos])
+		}
+	}
+	return "the changed lines were not found"
+}
+
+// patchTree holds the files of the usql code, changed by patches, in memory, so all patches are checked
+// before any file is written. A nil content marks a deleted file.
+type patchTree struct {
+	dir     string
+	changed map[string][]byte
+	// order lists changed paths in the order of the first change
+	order []string
+}
+
+func (t *patchTree) read(path string) ([]byte, bool, error) {
+	if content, ok := t.changed[path]; ok {
+		return content, content != nil, nil
+	}
+	content, err := os.ReadFile(filepath.Join(t.dir, filepath.FromSlash(path)))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	return content, err == nil, merry.Wrap(err)
+}
+
+func (t *patchTree) write(path string, content []byte) {
+	if _, ok := t.changed[path]; !ok {
+		t.order = append(t.order, path)
+	}
+	t.changed[path] = content
+}
+
+// apply applies the patch to the tree. It returns the conflicts, if the patch doesn't apply.
+func (t *patchTree) apply(patch filePatch) ([]string, error) {
+	var lines []string
+	eol := true
+	if patch.OldPath != "" {
+		content, exists, err := t.read(patch.OldPath)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return []string{"file doesn't exist"}, nil
+		}
+		lines, eol = splitLines(content)
+	} else if _, exists, err := t.read(patch.NewPath); err != nil || exists {
+		return []string{"file is added, but already exists"}, err
+	}
+
+	lines, eol, conflicts := applyHunks(lines, eol, patch.Hunks)
+	if patch.NewPath == "" && len(lines) > 0 {
+		conflicts = append(conflicts, "file is deleted, but has lines that are not in the patch")
+	}
+	if len(conflicts) > 0 {
+		return conflicts, nil
+	}
+	if patch.OldPath != "" && patch.OldPath != patch.NewPath {
+		t.write(patch.OldPath, nil)
+	}
+	if patch.NewPath != "" {
+		// non-nil, so an empty file isn't deleted
+		t.write(patch.NewPath, append([]byte{}, joinLines(lines, eol)...))
+	}
+	return nil, nil
+}
+
+// flush writes the changed files to the directory
+func (t *patchTree) flush() error {
+	for _, path := range t.order {
+		fullPath := filepath.Join(t.dir, filepath.FromSlash(path))
+		content := t.changed[path]
+		if content == nil {
+			if err := os.Remove(fullPath); err != nil {
+				return merry.Wrap(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(fullPath), fileMode); err != nil {
+			return merry.Wrap(err)
+		}
+		if err := os.WriteFile(fullPath, content, fileMode); err != nil {
+			return merry.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// patchedFileNames returns the files that the given patch files change
+func patchedFileNames(patchFiles []string) ([]string, error) {
+	var names []string
+	for _, patchFile := range patchFiles {
+		patches, err := readPatchFile(patchFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, patch := range patches {
+			names = append(names, lang.IfEmpty(patch.NewPath, patch.OldPath))
+		}
+	}
+	return names, nil
+}
+
+func readPatchFile(patchFile string) ([]filePatch, error) {
+	data, err := os.ReadFile(patchFile)
+	if err != nil {
+		return nil, merry.Prependf(err, "invalid --patch %q", patchFile)
+	}
+	patches, err := parseUnifiedDiff(data)
+	if err != nil {
+		return nil, merry.Prependf(err, "invalid --patch %q", patchFile)
+	}
+	for _, patch := range patches {
+		for _, path := range []string{patch.OldPath, patch.NewPath} {
+			if path != "" && !filepath.IsLocal(filepath.FromSlash(path)) {
+				return nil, merry.Errorf("invalid --patch %q: path %s is outside the usql module", patchFile, path)
+			}
+		}
+	}
+	return patches, nil
+}
+
+// applyPatches applies Patches to the downloaded usql code. If any hunk doesn't apply, no files are changed,
+// and all conflicts are reported.
+func (i Input) applyPatches(usqlVersion string) error {
+	tree := &patchTree{dir: i.WorkingDir, changed: make(map[string][]byte)}
+	var conflicts []string
+	for _, patchFile := range i.Patches {
+		patches, err := readPatchFile(patchFile)
+		if err != nil {
+			return err
+		}
+		for _, patch := range patches {
+			fileConflicts, err := tree.apply(patch)
+			if err != nil {
+				return err
+			}
+			for _, conflict := range fileConflicts {
+				conflicts = append(conflicts, fmt.Sprintf("%s: %s: %s", patchFile, lang.IfEmpty(patch.OldPath, patch.NewPath), conflict))
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		return merry.Errorf("--patch doesn't apply to usql %s:\n  %s", usqlVersion, strings.Join(conflicts, "\n  "))
+	}
+	return tree.flush()
+}
@@ -0,0 +1,118 @@
+package gen
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const patchTestMain = `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("hello")
+}
+`
+
+// patchTestDiff is in git diff format. The first hunk expects the original at line 3, but the file has extra lines.
+const patchTestDiff = `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -3,5 +3,5 @@
+ import "fmt"
+
+ func main() {
+-	fmt.Println("hello")
++	fmt.Println("hello, world")
+ }
+diff --git a/fix.go b/fix.go
+new file mode 100644
+--- /dev/null
++++ b/fix.go
+@@ -0,0 +1,2 @@
++package main
++// fix
+\ No newline at end of file
+diff --git a/old.go b/old.go
+deleted file mode 100644
+--- a/old.go
++++ /dev/null
+@@ -1 +0,0 @@
+-package main
+`
+
+func TestInput_ApplyPatches(t *testing.T) {
+	setup := func(t *testing.T, diff string) Input {
+		dir := t.TempDir()
+		main := strings.Replace(patchTestMain, "package main\n", "// Package main\npackage main\n", 1)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte(main), fileMode))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "old.go"), []byte("package main\n"), fileMode))
+		patchFile := filepath.Join(t.TempDir(), "fix.diff")
+		require.NoError(t, os.WriteFile(patchFile, []byte(diff), fileMode))
+		return Input{WorkingDir: dir, Patches: []string{patchFile}}
+	}
+
+	t.Run("applies", func(t *testing.T) {
+		inp := setup(t, patchTestDiff)
+		require.NoError(t, inp.Validate())
+		require.NoError(t, inp.applyPatches("v0.19.14"))
+
+		main, err := os.ReadFile(filepath.Join(inp.WorkingDir, "main.go"))
+		require.NoError(t, err)
+		require.Contains(t, string(main), "// Package main\n")
+		require.Contains(t, string(main), "\tfmt.Println(\"hello, world\")\n}\n")
+		fix, err := os.ReadFile(filepath.Join(inp.WorkingDir, "fix.go"))
+		require.NoError(t, err)
+		require.Equal(t, "package main\n// fix", string(fix))
+		require.NoFileExists(t, filepath.Join(inp.WorkingDir, "old.go"))
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		inp := setup(t, strings.Replace(patchTestDiff, `-	fmt.Println("hello")`, `-	fmt.Println("bye")`, 1))
+		err := inp.applyPatches("v0.19.14")
+		require.ErrorContains(t, err, "--patch doesn't apply to usql v0.19.14")
+		require.ErrorContains(t, err, `main.go: hunk #1 @@ -3,5 +3,5 @@: expected "\tfmt.Println(\"bye\")" at line 7, found "\tfmt.Println(\"hello\")"`)
+		// nothing is changed, if any hunk conflicts
+		require.FileExists(t, filepath.Join(inp.WorkingDir, "old.go"))
+		require.NoFileExists(t, filepath.Join(inp.WorkingDir, "fix.go"))
+	})
+
+	t.Run("ambiguous", func(t *testing.T) {
+		inp := setup(t, "--- a/twice.txt\n+++ b/twice.txt\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n")
+		require.NoError(t, os.WriteFile(filepath.Join(inp.WorkingDir, "twice.txt"), []byte("a\nb\na\nb\n"), fileMode))
+		err := inp.applyPatches("v0.19.14")
+		require.ErrorContains(t, err, "hunk #1 @@ -1,2 +1,2 @@: the context matches at lines 1, 3")
+	})
+
+	t.Run("too far", func(t *testing.T) {
+		inp := setup(t, patchTestDiff)
+		main := strings.Repeat("// moved\n", hunkWindow+1) + patchTestMain
+		require.NoError(t, os.WriteFile(filepath.Join(inp.WorkingDir, "main.go"), []byte(main), fileMode))
+		err := inp.applyPatches("v0.19.14")
+		require.ErrorContains(t, err, "main.go: hunk #1 @@ -3,5 +3,5 @@")
+		require.FileExists(t, filepath.Join(inp.WorkingDir, "old.go"))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		inp := setup(t, "--- a/main.go\n+++ b/main.go\n@@ -1,2 +1,2 @@\n package main\n")
+		require.ErrorContains(t, inp.Validate(), "truncated")
+		inp = setup(t, "--- a/../main.go\n+++ b/../main.go\n@@ -1 +1 @@\n-package main\n+package other\n")
+		require.ErrorContains(t, inp.Validate(), "outside the usql module")
+	})
+
+	t.Run("unsupported git headers", func(t *testing.T) {
+		for header, reason := range map[string]string{
+			"similarity index 100%\nrename from main.go\nrename to other.go\n":      "renames are not supported",
+			"old mode 100644\nnew mode 100755\n":                                    "file mode changes are not supported",
+			"index 1111111..2222222\nBinary files a/main.go and b/main.go differ\n": "binary changes are not supported",
+		} {
+			inp := setup(t, "diff --git a/main.go b/main.go\n"+header)
+			require.ErrorContains(t, inp.Validate(), reason)
+		}
+	})
+}
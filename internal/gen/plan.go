@@ -0,0 +1,132 @@
+package gen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/ansel1/merry/v2"
+	"github.com/sclgo/usqlgen/internal/run"
+)
+
+// Plan describes what AllDownload would do for a given Input, without doing it
+type Plan struct {
+	// USQLModule is the requested usql module and version e.g. github.com/xo/usql@latest
+	USQLModule string `json:"usqlModule"`
+	// ResolvedVersion is the concrete version USQLModule resolves to
+	ResolvedVersion string `json:"resolvedVersion"`
+
+	GeneratedFiles []string       `json:"generatedFiles"`
+	PatchedFiles   []PlannedPatch `json:"patchedFiles,omitempty"`
+	// SourcePatchedFiles are the usql files that --patch files change, before PatchedFiles are patched
+	SourcePatchedFiles []string `json:"sourcePatchedFiles,omitempty"`
+	// InitSnippets are the statements that init functions of the generated main package run
+	InitSnippets []string `json:"initSnippets,omitempty"`
+	// Connectors are the drivers, registered with connectors, formatted as name: package.Func
+	Connectors []string `json:"connectors,omitempty"`
+
+	// The go.mod of the generated module is updated in this order: GoGet, GoModEdits, Tidy.
+	GoGet      *PlannedCommand `json:"goGet,omitempty"`
+	GoModEdits []string        `json:"goModEdits,omitempty"`
+	Tidy       *PlannedCommand `json:"tidy,omitempty"`
+}
+
+// PlannedPatch is a modification of a file in the usql code
+type PlannedPatch struct {
+	File   string `json:"file"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// PlannedCommand is a go command, executed as a step of the usqlgen pipeline
+type PlannedCommand struct {
+	Step string   `json:"step"`
+	Env  []string `json:"env,omitempty"`
+	Args []string `json:"args"`
+}
+
+// String formats the command similar to how it would be typed in a shell
+func (c PlannedCommand) String() string {
+	parts := append(append([]string(nil), c.Env...), "go")
+	for _, arg := range c.Args {
+		parts = append(parts, shellQuote(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+func shellQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n\"'\\$`*?&|;<>()[]{}#~") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Plan validates the input and returns what AllDownload would do with it.
+// The only go command it runs is a query that resolves the requested usql version.
+func (i Input) Plan(ctx context.Context) (Plan, error) {
+	err := i.Validate()
+	if err != nil {
+		return Plan{}, err
+	}
+
+	plan := Plan{
+		USQLModule:     i.getUSQLModuleVersion(),
+		GeneratedFiles: []string{"gen/dbmgr.go"},
+		GoGet:          i.goGetCommand(),
+		GoModEdits:     i.goModEdits(),
+		Tidy:           i.tidyCommand(),
+	}
+
+	plan.ResolvedVersion, err = resolveVersion(ctx, plan.USQLModule)
+	if err != nil {
+		return plan, err
+	}
+
+	plan.SourcePatchedFiles, err = patchedFileNames(i.Patches)
+	if err != nil {
+		return plan, err
+	}
+	if i.shouldReplaceMain() {
+		plan.GeneratedFiles = append([]string{"new_main.go"}, plan.GeneratedFiles...)
+		plan.PatchedFiles = append(plan.PatchedFiles, mainPatch.planned())
+	}
+	for _, c := range i.ConnectorsByName() {
+		plan.Connectors = append(plan.Connectors, c.Name+": "+c.Package+"."+c.Func)
+	}
+	plan.GeneratedFiles = append(plan.GeneratedFiles, i.initFileNames()...)
+	if len(i.InitSnippets) > 0 {
+		plan.GeneratedFiles = append(plan.GeneratedFiles, initSnippetsFile)
+		plan.InitSnippets = i.InitSnippets
+	}
+	if i.PGOProfile != "" {
+		plan.GeneratedFiles = append(plan.GeneratedFiles, pgoFile)
+	}
+	if !i.KeepCgo {
+		for _, patch := range cgoTagPatches {
+			plan.PatchedFiles = append(plan.PatchedFiles, patch.planned())
+		}
+	}
+	return plan, nil
+}
+
+// resolveVersion queries the concrete version of the given module@version
+func resolveVersion(ctx context.Context, moduleVersion string) (string, error) {
+	var output bytes.Buffer
+	err := run.Command{
+		// the query should not be affected by the module, if any, in the current directory
+		Dir:    os.TempDir(),
+		GoBin:  run.FindGo(),
+		Args:   []string{"list", "-m", "-json", moduleVersion},
+		Stdout: &output,
+	}.Run(ctx)
+	if err != nil {
+		return "", err
+	}
+	var info struct {
+		Version string
+	}
+	err = json.Unmarshal(output.Bytes(), &info)
+	return info.Version, merry.Wrap(err)
+}
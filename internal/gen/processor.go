@@ -0,0 +1,93 @@
+package gen
+
+import (
+	"fmt"
+	"go/token"
+	"slices"
+	"strings"
+
+	"github.com/ansel1/merry/v2"
+	"golang.org/x/mod/module"
+)
+
+// Processor is a parsed processor spec driver:package.Symbol. Symbol is an exported variable in package,
+// whose type implements StatementProcessor. The generated Process function of driver calls it.
+type Processor struct {
+	Driver  string
+	Package string
+	Symbol  string
+	// Alias is the name of the package in the generated main package. It is set by ProcessorsByDriver.
+	Alias string
+}
+
+// ParseProcessor parses a processor spec driver:package.Symbol e.g. mssql:github.com/acme/tsql.Processor
+func ParseProcessor(spec string) (Processor, error) {
+	var p Processor
+	driver, ref, found := strings.Cut(spec, ":")
+	p.Driver = strings.TrimSpace(driver)
+	if !found || p.Driver == "" {
+		return p, merry.Errorf("invalid --processor %q: expected format driver:package.Symbol e.g. mssql:github.com/acme/tsql.Processor", spec)
+	}
+	var err error
+	p.Package, p.Symbol, err = parseSymbolRef("--processor", spec, ref)
+	return p, err
+}
+
+// parseSymbolRef parses a reference package.Symbol to an exported symbol in a Go package,
+// found in the given spec of the given flag
+func parseSymbolRef(flag string, spec string, ref string) (string, string, error) {
+	ref = strings.TrimSpace(ref)
+	dot := strings.LastIndex(ref, ".")
+	if dot < 0 {
+		return "", "", merry.Errorf("invalid %s %q: expected package.Symbol e.g. github.com/acme/tsql.Processor", flag, spec)
+	}
+	pkg, symbol := ref[:dot], ref[dot+1:]
+	if err := module.CheckImportPath(pkg); err != nil {
+		return pkg, symbol, merry.Prependf(err, "invalid %s %q", flag, spec)
+	}
+	if !token.IsIdentifier(symbol) || !token.IsExported(symbol) {
+		return pkg, symbol, merry.Errorf("invalid %s %q: %s is not an exported Go identifier", flag, spec, symbol)
+	}
+	return pkg, symbol, nil
+}
+
+// packageAliases assigns names, starting with prefix, to the given packages for imports in the generated
+// main package. Aliases don't depend on the order of packages.
+func packageAliases(prefix string, packages []string) map[string]string {
+	aliases := make(map[string]string, len(packages))
+	sorted := slices.Compact(slices.Sorted(slices.Values(packages)))
+	for idx, pkg := range sorted {
+		aliases[pkg] = fmt.Sprintf("%s%d", prefix, idx)
+	}
+	return aliases
+}
+
+// ProcessorsByDriver returns the parsed Processors by driver name, with aliases assigned per package.
+// It assumes that the Input was validated.
+func (i Input) ProcessorsByDriver() map[string]Processor {
+	processors := make(map[string]Processor, len(i.Processors))
+	var packages []string
+	for _, spec := range i.Processors {
+		p, err := ParseProcessor(spec)
+		if err != nil {
+			continue
+		}
+		packages = append(packages, p.Package)
+		processors[p.Driver] = p
+	}
+	aliases := packageAliases("processor", packages)
+	for driver, p := range processors {
+		p.Alias = aliases[p.Package]
+		processors[driver] = p
+	}
+	return processors
+}
+
+// ProcessorImports returns the packages of Processors by their alias
+func (i Input) ProcessorImports() map[string]string {
+	imports := make(map[string]string)
+	for _, p := range i.ProcessorsByDriver() {
+		imports[p.Alias] = p.Package
+	}
+	return imports
+}
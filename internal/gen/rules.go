@@ -0,0 +1,71 @@
+package gen
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/ansel1/merry/v2"
+)
+
+// ParseRewrite parses a rewrite spec driver:/pattern/replacement/. Any character that doesn't appear in
+// pattern and replacement can be used as delimiter instead of / e.g. driver:|pattern|replacement|
+func ParseRewrite(spec string) (string, Rewrite, error) {
+	driver, rule, found := strings.Cut(spec, ":")
+	driver = strings.TrimSpace(driver)
+	rule = strings.TrimSpace(rule)
+	if !found || driver == "" || len(rule) < 3 {
+		return driver, Rewrite{}, merry.Errorf("invalid --rewrite %q: expected format driver:/pattern/replacement/", spec)
+	}
+	delimiter := rule[:1]
+	parts := strings.Split(rule[1:], delimiter)
+	if len(parts) != 3 || parts[2] != "" || parts[0] == "" {
+		return driver, Rewrite{}, merry.Errorf("invalid --rewrite %q: expected format driver:%spattern%sreplacement%s", spec, delimiter, delimiter, delimiter)
+	}
+	rewrite := Rewrite{Pattern: parts[0], Replacement: parts[1]}
+	if _, err := regexp.Compile(rewrite.Pattern); err != nil {
+		return driver, rewrite, merry.Prependf(err, "invalid --rewrite %q", spec)
+	}
+	return driver, rewrite, nil
+}
+
+// ParseClassification parses a classification spec driver:query=pattern or driver:exec=pattern
+func ParseClassification(spec string) (string, Classification, error) {
+	var classification Classification
+	driver, rule, found := strings.Cut(spec, ":")
+	driver = strings.TrimSpace(driver)
+	kind, pattern, hasPattern := strings.Cut(rule, "=")
+	kind = strings.TrimSpace(kind)
+	if !found || driver == "" || !hasPattern || pattern == "" || (kind != "query" && kind != "exec") {
+		return driver, classification, merry.Errorf("invalid --classify %q: expected format driver:query=pattern or driver:exec=pattern", spec)
+	}
+	classification = Classification{Pattern: pattern, Query: kind == "query"}
+	if _, err := regexp.Compile(pattern); err != nil {
+		return driver, classification, merry.Prependf(err, "invalid --classify %q", spec)
+	}
+	return driver, classification, nil
+}
+
+// StatementRulesByDriver returns the parsed Rewrites and Classifications by driver name, in the order given.
+// It assumes that the Input was validated.
+func (i Input) StatementRulesByDriver() map[string]StatementRules {
+	rules := make(map[string]StatementRules)
+	for _, spec := range i.Rewrites {
+		driver, rewrite, err := ParseRewrite(spec)
+		if err != nil {
+			continue
+		}
+		driverRules := rules[driver]
+		driverRules.Rewrites = append(driverRules.Rewrites, rewrite)
+		rules[driver] = driverRules
+	}
+	for _, spec := range i.Classifications {
+		driver, classification, err := ParseClassification(spec)
+		if err != nil {
+			continue
+		}
+		driverRules := rules[driver]
+		driverRules.Classifications = append(driverRules.Classifications, classification)
+		rules[driver] = driverRules
+	}
+	return rules
+}
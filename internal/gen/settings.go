@@ -0,0 +1,85 @@
+package gen
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/ansel1/merry/v2"
+)
+
+var (
+	// variableNameRE matches names of usql variables and environment variables
+	variableNameRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// printVariableNameRE matches names of \pset options e.g. tuples_only
+	printVariableNameRE = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+)
+
+// parseSetting parses a NAME=VALUE spec of flag. The value may be empty.
+func parseSetting(flag string, spec string, nameRE *regexp.Regexp) (string, string, error) {
+	name, value, found := strings.Cut(spec, "=")
+	name = strings.TrimSpace(name)
+	if !found {
+		return "", "", merry.Errorf("invalid %s %q: expected format NAME=VALUE", flag, spec)
+	}
+	if !nameRE.MatchString(name) {
+		return "", "", merry.Errorf("invalid %s %q: invalid name %q", flag, spec, name)
+	}
+	return name, value, nil
+}
+
+// validateSettings checks that specs of flag are valid and don't set the same name twice
+func validateSettings(flag string, specs []string, nameRE *regexp.Regexp) error {
+	seen := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		name, _, err := parseSetting(flag, spec, nameRE)
+		if err != nil {
+			return err
+		}
+		if prev, ok := seen[name]; ok {
+			return merry.Errorf("conflicting %s %q and %s %q", flag, prev, flag, spec)
+		}
+		seen[name] = spec
+	}
+	return nil
+}
+
+// settingsByName returns the NAME=VALUE specs as a map. It assumes that the specs were validated.
+func settingsByName(flag string, specs []string, nameRE *regexp.Regexp) map[string]string {
+	settings := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		name, value, err := parseSetting(flag, spec, nameRE)
+		if err == nil {
+			settings[name] = value
+		}
+	}
+	return settings
+}
+
+// VariablesByName returns Variables as a map from name to value. It assumes that the Input was validated.
+func (i Input) VariablesByName() map[string]string {
+	return settingsByName("--set", i.Variables, variableNameRE)
+}
+
+// PrintVariablesByName returns PrintVariables as a map from name to value. It assumes that the Input was validated.
+func (i Input) PrintVariablesByName() map[string]string {
+	return settingsByName("--pset", i.PrintVariables, printVariableNameRE)
+}
+
+// EnvDefaultsByName returns EnvDefaults as a map from name to value. It assumes that the Input was validated.
+func (i Input) EnvDefaultsByName() map[string]string {
+	return settingsByName("--setenv", i.EnvDefaults, variableNameRE)
+}
+
+func (i Input) hasSettings() bool {
+	return len(i.Variables) > 0 || len(i.PrintVariables) > 0 || len(i.EnvDefaults) > 0
+}
+
+func (i Input) validateSettings() error {
+	if err := validateSettings("--set", i.Variables, variableNameRE); err != nil {
+		return err
+	}
+	if err := validateSettings("--pset", i.PrintVariables, printVariableNameRE); err != nil {
+		return err
+	}
+	return validateSettings("--setenv", i.EnvDefaults, variableNameRE)
+}
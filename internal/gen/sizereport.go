@@ -0,0 +1,405 @@
+package gen
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"debug/buildinfo"
+	"debug/elf"
+	"debug/gosym"
+	"debug/macho"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ansel1/merry/v2"
+	"github.com/murfffi/gorich/lang"
+	"github.com/samber/lo"
+	"github.com/sclgo/usqlgen/internal/run"
+)
+
+const (
+	// stdModule is the pseudo-module of standard library packages and runtime-generated functions
+	stdModule = "std"
+
+	maxReportedModules  = 15
+	maxSuggestedTags    = 5
+	minSuggestedSavings = 1 << 20
+)
+
+// SizeReport breaks down the code size of a usql executable by module and suggests no_xxx build tags that
+// remove the drivers that contribute the most code
+type SizeReport struct {
+	Executable string `json:"executable"`
+	// FileSize is the size of the executable file
+	FileSize int64 `json:"fileSize"`
+	// CodeSize is the total size of the Go functions in the executable
+	CodeSize    uint64          `json:"codeSize"`
+	Modules     []ModuleSize    `json:"modules"`
+	Suggestions []TagSuggestion `json:"suggestions,omitempty"`
+}
+
+// ModuleSize is the size of the functions of a module in the executable
+type ModuleSize struct {
+	Module string `json:"module"`
+	Size   uint64 `json:"size"`
+	// Tags lists the usql driver tags e.g. mysql, whose drivers depend on packages in the module
+	Tags []string `json:"tags,omitempty"`
+}
+
+// TagSuggestion is a no_xxx build tag that removes a usql driver
+type TagSuggestion struct {
+	Tag string `json:"tag"`
+	// Savings is the code size of packages that only the driver depends on
+	Savings uint64 `json:"savings"`
+}
+
+// listedPackage is the output of go list -deps for a package in the executable
+type listedPackage struct {
+	ImportPath string
+	Imports    []string
+	Module     *struct {
+		Path string
+	}
+}
+
+// BuildOptions are the environment variables and build flags, the generated code was compiled with
+type BuildOptions struct {
+	Env   []string
+	Flags []string
+}
+
+// BuildSizeReport analyzes the symbol table of the given executable, built from the generated code in workingDir.
+// It supports ELF and Mach-O executables.
+func BuildSizeReport(ctx context.Context, workingDir string, executable string, build BuildOptions) (SizeReport, error) {
+	report := SizeReport{Executable: executable}
+	stat, err := os.Stat(executable)
+	if err != nil {
+		return report, merry.Wrap(err)
+	}
+	report.FileSize = stat.Size()
+
+	packageSizes, err := functionSizesByPackage(executable)
+	if err != nil {
+		return report, err
+	}
+	info, err := buildinfo.ReadFile(executable)
+	if err != nil {
+		return report, merry.Wrap(err)
+	}
+	packages, err := listPackages(ctx, workingDir, build)
+	if err != nil {
+		return report, err
+	}
+	driverTags, err := readDriverTags(workingDir, info.Main.Path)
+	if err != nil {
+		return report, err
+	}
+
+	graph := newPackageGraph(packages)
+	tagPackages := make(map[string]map[string]bool, len(driverTags))
+	var driverPackages []string
+	for tag, drivers := range driverTags {
+		tagPackages[tag] = graph.reachable(drivers...)
+		driverPackages = append(driverPackages, drivers...)
+	}
+	// base contains all packages that are linked regardless of the no_xxx tags
+	internalPackage := info.Main.Path + "/internal"
+	base := graph.reachable(lo.Without(graph.roots(internalPackage), driverPackages...)...)
+
+	moduleSizes := make(map[string]*ModuleSize)
+	for pkg, size := range packageSizes {
+		report.CodeSize += size
+		module := graph.moduleOf(pkg)
+		moduleSize, ok := moduleSizes[module]
+		if !ok {
+			moduleSize = &ModuleSize{Module: module}
+			moduleSizes[module] = moduleSize
+		}
+		moduleSize.Size += size
+		if module == stdModule {
+			// nearly all drivers use the standard library
+			continue
+		}
+		for tag, reachable := range tagPackages {
+			if reachable[pkg] && !slices.Contains(moduleSize.Tags, tag) {
+				moduleSize.Tags = append(moduleSize.Tags, tag)
+			}
+		}
+	}
+	for _, moduleSize := range moduleSizes {
+		slices.Sort(moduleSize.Tags)
+		report.Modules = append(report.Modules, *moduleSize)
+	}
+	slices.SortFunc(report.Modules, func(a, b ModuleSize) int {
+		return cmp.Or(cmp.Compare(b.Size, a.Size), cmp.Compare(a.Module, b.Module))
+	})
+
+	report.Suggestions = suggestTags(packageSizes, tagPackages, base)
+	return report, nil
+}
+
+// suggestTags returns the no_xxx tags that would remove the most code, based on the packages, that are
+// reachable only from the drivers of the tag
+func suggestTags(packageSizes map[string]uint64, tagPackages map[string]map[string]bool, base map[string]bool) []TagSuggestion {
+	var suggestions []TagSuggestion
+	for tag, reachable := range tagPackages {
+		suggestion := TagSuggestion{Tag: "no_" + tag}
+		for pkg := range reachable {
+			exclusive := !base[pkg]
+			for otherTag, otherReachable := range tagPackages {
+				exclusive = exclusive && (otherTag == tag || !otherReachable[pkg])
+			}
+			if exclusive {
+				suggestion.Savings += packageSizes[pkg]
+			}
+		}
+		if suggestion.Savings >= minSuggestedSavings {
+			suggestions = append(suggestions, suggestion)
+		}
+	}
+	slices.SortFunc(suggestions, func(a, b TagSuggestion) int {
+		return cmp.Or(cmp.Compare(b.Savings, a.Savings), cmp.Compare(a.Tag, b.Tag))
+	})
+	return suggestions[:min(len(suggestions), maxSuggestedTags)]
+}
+
+// functionSizesByPackage sums the sizes of functions in the pclntab of the executable by package
+func functionSizesByPackage(executable string) (map[string]uint64, error) {
+	pclntab, textStart, err := readPclntab(executable)
+	if err != nil {
+		return nil, err
+	}
+	table, err := gosym.NewTable(nil, gosym.NewLineTable(pclntab, textStart))
+	if err != nil {
+		return nil, merry.Prependf(err, "failed to read symbol table of %s", executable)
+	}
+	sizes := make(map[string]uint64)
+	for _, fn := range table.Funcs {
+		sizes[fn.PackageName()] += fn.End - fn.Entry
+	}
+	return sizes, nil
+}
+
+// readPclntab returns the Go symbol table of the executable and the start address of its code
+func readPclntab(executable string) ([]byte, uint64, error) {
+	if elfFile, err := elf.Open(executable); err == nil {
+		defer func() {
+			_ = elfFile.Close()
+		}()
+		pclntab, text := elfFile.Section(".gopclntab"), elfFile.Section(".text")
+		if pclntab == nil || text == nil {
+			return nil, 0, merry.Errorf("%s has no Go symbol table; it may have been stripped", executable)
+		}
+		data, err := pclntab.Data()
+		return data, text.Addr, merry.Wrap(err)
+	}
+	if machoFile, err := macho.Open(executable); err == nil {
+		defer func() {
+			_ = machoFile.Close()
+		}()
+		pclntab, text := machoFile.Section("__gopclntab"), machoFile.Section("__text")
+		if pclntab == nil || text == nil {
+			return nil, 0, merry.Errorf("%s has no Go symbol table; it may have been stripped", executable)
+		}
+		data, err := pclntab.Data()
+		return data, text.Addr, merry.Wrap(err)
+	}
+	return nil, 0, merry.Errorf("size report supports only ELF and Mach-O executables; %s is neither", executable)
+}
+
+// listPackages lists all packages linked into the generated main package with their imports.
+// build contains the environment and the build flags of the compilation, so the same files are selected.
+func listPackages(ctx context.Context, workingDir string, build BuildOptions) ([]listedPackage, error) {
+	var output bytes.Buffer
+	args := []string{"list", "-mod=mod", "-e", "-deps", "-json=ImportPath,Imports,Module"}
+	args = append(args, build.Flags...)
+	err := run.Command{
+		Dir:    workingDir,
+		AddEnv: build.Env,
+		GoBin:  run.FindGo(),
+		Args:   append(args, "."),
+		Stdout: &output,
+	}.Run(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []listedPackage
+	decoder := json.NewDecoder(&output)
+	for {
+		var pkg listedPackage
+		err = decoder.Decode(&pkg)
+		if errors.Is(err, io.EOF) {
+			return packages, nil
+		}
+		if err != nil {
+			return nil, merry.Wrap(err)
+		}
+		packages = append(packages, pkg)
+	}
+}
+
+// readDriverTags reads the go:build constraints of the usql internal package and returns the driver packages
+// that each no_xxx tag excludes, by tag name without the no_ prefix
+func readDriverTags(workingDir string, usqlModule string) (map[string][]string, error) {
+	files, err := filepath.Glob(filepath.Join(workingDir, "internal", "*.go"))
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	driverTags := make(map[string][]string)
+	fset := token.NewFileSet()
+	for _, file := range files {
+		parsed, err := parser.ParseFile(fset, file, nil, parser.ImportsOnly|parser.ParseComments)
+		if err != nil {
+			return nil, merry.Wrap(err)
+		}
+		tag := excludingTag(parsed.Comments)
+		if tag == "" {
+			continue
+		}
+		for _, imp := range parsed.Imports {
+			path, err := strconv.Unquote(imp.Path.Value)
+			if err == nil && strings.HasPrefix(path, usqlModule+"/drivers/") {
+				driverTags[tag] = append(driverTags[tag], path)
+			}
+		}
+	}
+	return driverTags, nil
+}
+
+// excludingTag returns xxx if the go:build constraint in the comments contains !no_xxx
+func excludingTag(comments []*ast.CommentGroup) string {
+	for _, group := range comments {
+		for _, comment := range group.List {
+			if !constraint.IsGoBuild(comment.Text) {
+				continue
+			}
+			expr, err := constraint.Parse(comment.Text)
+			if err != nil {
+				return ""
+			}
+			return negatedNoTag(expr)
+		}
+	}
+	return ""
+}
+
+// negatedNoTag returns xxx for the first !no_xxx in the expression
+func negatedNoTag(expr constraint.Expr) string {
+	switch e := expr.(type) {
+	case *constraint.NotExpr:
+		if tag, ok := e.X.(*constraint.TagExpr); ok {
+			driverTag, _ := strings.CutPrefix(tag.Tag, "no_")
+			return lo.Ternary(driverTag != tag.Tag, driverTag, "")
+		}
+		return negatedNoTag(e.X)
+	case *constraint.AndExpr:
+		return lang.IfEmpty(negatedNoTag(e.X), negatedNoTag(e.Y))
+	case *constraint.OrExpr:
+		return lang.IfEmpty(negatedNoTag(e.X), negatedNoTag(e.Y))
+	}
+	return ""
+}
+
+// packageGraph is the import graph of the packages in the executable
+type packageGraph struct {
+	imports map[string][]string
+	modules map[string]string
+	// main is the import path of the main package
+	main string
+}
+
+func newPackageGraph(packages []listedPackage) packageGraph {
+	graph := packageGraph{
+		imports: make(map[string][]string, len(packages)),
+		modules: make(map[string]string, len(packages)),
+	}
+	for _, pkg := range packages {
+		graph.imports[pkg.ImportPath] = pkg.Imports
+		graph.modules[pkg.ImportPath] = stdModule
+		if pkg.Module != nil {
+			graph.modules[pkg.ImportPath] = pkg.Module.Path
+		}
+	}
+	if len(packages) > 0 {
+		// go list -deps lists the packages given as arguments last
+		graph.main = packages[len(packages)-1].ImportPath
+	}
+	return graph
+}
+
+// roots returns the imports of the main package and of the given package, replacing the package itself
+func (g packageGraph) roots(replaced string) []string {
+	roots := lo.Without(g.imports[g.main], replaced)
+	return append(roots, g.imports[replaced]...)
+}
+
+// reachable returns the given packages and all packages they import, directly or indirectly
+func (g packageGraph) reachable(from ...string) map[string]bool {
+	result := make(map[string]bool)
+	queue := slices.Clone(from)
+	for len(queue) > 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+		if _, linked := g.imports[pkg]; !linked || result[pkg] {
+			continue
+		}
+		result[pkg] = true
+		queue = append(queue, g.imports[pkg]...)
+	}
+	return result
+}
+
+// moduleOf returns the module of the package, as named in the symbol table
+func (g packageGraph) moduleOf(pkg string) string {
+	if module, ok := g.modules[pkg]; ok {
+		return module
+	}
+	// functions of packages, unknown to go list, are usually generated by the compiler or the linker
+	return stdModule
+}
+
+// Text formats the report for display
+func (r SizeReport) Text() string {
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "usql executable %s: %s, of which Go code %s\n", r.Executable, formatSize(uint64(max(r.FileSize, 0))), formatSize(r.CodeSize))
+	sb.WriteString("code size by module:\n")
+	tw := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	for _, module := range r.Modules[:min(len(r.Modules), maxReportedModules)] {
+		line := fmt.Sprintf("  %s\t%s", module.Module, formatSize(module.Size))
+		if len(module.Tags) > 0 {
+			line += "\tused by drivers: " + strings.Join(module.Tags, ", ")
+		}
+		_, _ = fmt.Fprintln(tw, line)
+	}
+	_ = tw.Flush()
+	if len(r.Suggestions) == 0 {
+		return sb.String()
+	}
+
+	sb.WriteString("build tags that remove the largest drivers, if you don't use them:\n")
+	tw = tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	for _, suggestion := range r.Suggestions {
+		_, _ = fmt.Fprintf(tw, "  %s\tsaves ~%s\n", suggestion.Tag, formatSize(suggestion.Savings))
+	}
+	_ = tw.Flush()
+	tags := lo.Map(r.Suggestions, func(s TagSuggestion, _ int) string { return s.Tag })
+	_, _ = fmt.Fprintf(&sb, "e.g. usqlgen build ... -- -tags %s\n", strings.Join(tags, ","))
+	return sb.String()
+}
+
+func formatSize(size uint64) string {
+	return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+}
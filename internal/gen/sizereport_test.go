@@ -0,0 +1,67 @@
+package gen
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildSizeReport(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":               "module github.com/xo/usql\n\ngo 1.23\n",
+		"main.go":              "package main\n\nimport _ \"github.com/xo/usql/internal\"\n\nfunc main() {}\n",
+		"internal/internal.go": "package internal\n",
+		"internal/alpha.go": "//go:build (all || most || alpha) && !no_alpha\n\npackage internal\n\n" +
+			"import _ \"github.com/xo/usql/drivers/alpha\"\n",
+		"drivers/alpha/alpha.go": "package alpha\n\nimport \"fmt\"\n\nfunc init() { fmt.Println(\"alpha\") }\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), fileMode))
+		require.NoError(t, os.WriteFile(path, []byte(content), fileMode))
+	}
+	executable := filepath.Join(dir, "usql")
+	cmd := exec.Command("go", "build", "-tags", "most", "-o", executable, ".")
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+
+	report, err := BuildSizeReport(t.Context(), dir, executable, BuildOptions{Flags: []string{"-tags", "most"}})
+	if err != nil && err.Error() == "size report supports only ELF and Mach-O executables; "+executable+" is neither" {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+	require.Positive(t, report.CodeSize)
+	require.Equal(t, stdModule, report.Modules[0].Module)
+	require.Empty(t, report.Modules[0].Tags)
+	usqlModule, found := lo.Find(report.Modules, func(m ModuleSize) bool {
+		return m.Module == "github.com/xo/usql"
+	})
+	require.True(t, found)
+	require.Equal(t, []string{"alpha"}, usqlModule.Tags)
+	require.Contains(t, report.Text(), "code size by module:\n  std")
+}
+
+func TestSuggestTags(t *testing.T) {
+	packageSizes := map[string]uint64{
+		"fmt":       5 << 20,
+		"grpc":      3 << 20,
+		"alpha":     2 << 20,
+		"beta":      1 << 20,
+		"beta/deps": 1 << 20,
+	}
+	tagPackages := map[string]map[string]bool{
+		"alpha": {"alpha": true, "grpc": true, "fmt": true},
+		"beta":  {"beta": true, "beta/deps": true, "grpc": true},
+	}
+	base := map[string]bool{"fmt": true}
+	require.Equal(t, []TagSuggestion{
+		{Tag: "no_alpha", Savings: 2 << 20},
+		{Tag: "no_beta", Savings: 2 << 20},
+	}, suggestTags(packageSizes, tagPackages, base))
+}
@@ -0,0 +1,156 @@
+package gen
+
+import (
+	"bytes"
+	"go/ast"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+
+	"github.com/ansel1/merry/v2"
+	"github.com/samber/lo"
+)
+
+// usqlPatch is a verified modification of a file in the downloaded usql code
+type usqlPatch struct {
+	// Name identifies the patch in errors
+	Name    string
+	RelPath string
+	// Before and After describe the modification in plans
+	Before string
+	After  string
+	// apply returns the modified file content, or an error if the content is not what the patch expects
+	apply func(content []byte) ([]byte, error)
+}
+
+var mainPatch = usqlPatch{
+	Name:    "rename main",
+	RelPath: "main.go",
+	Before:  "func main()",
+	After:   "func origMain()",
+	apply:   renameFunc("main", "origMain"),
+}
+
+var cgoTagPatches = []usqlPatch{
+	{
+		Name:    "require cgo for sqlite3",
+		RelPath: filepath.Join("internal", "sqlite3.go"),
+		Before:  "!no_base",
+		After:   "!no_base && cgo",
+		apply:   replaceInBuildConstraint("!no_base", "!no_base && cgo"),
+	},
+	// we must include moderncsqlite *only* if sqlite3 was excluded because of !cgo
+	{
+		Name:    "use moderncsqlite without cgo",
+		RelPath: filepath.Join("internal", "moderncsqlite.go"),
+		Before:  "most",
+		After:   "most || (!cgo && !no_base && !no_sqlite3)",
+		apply:   replaceInBuildConstraint("most", "most || (!cgo && !no_base && !no_sqlite3)"),
+	},
+
+	// usql already contains code that assigns sqlite3 aliases to moderncsqlite,
+	// if moderncsqlite is present but sqlite3 is not - usql/internal/z.go
+}
+
+// renameFunc returns a patch function that renames the top-level function from to, after checking
+// that the file declares from, but not to
+func renameFunc(from string, to string) func(content []byte) ([]byte, error) {
+	return func(content []byte) ([]byte, error) {
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, "", content, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, merry.Wrap(err)
+		}
+		var target *ast.Ident
+		for _, decl := range file.Decls {
+			funcDecl, ok := decl.(*ast.FuncDecl)
+			if !ok || funcDecl.Recv != nil {
+				continue
+			}
+			switch funcDecl.Name.Name {
+			case to:
+				return nil, merry.Errorf("func %s is already declared", to)
+			case from:
+				target = funcDecl.Name
+			}
+		}
+		if target == nil {
+			return nil, merry.Errorf("func %s not found", from)
+		}
+		offset := fset.Position(target.Pos()).Offset
+		patched := append(append(bytes.Clone(content[:offset]), to...), content[offset+len(from):]...)
+		return patched, nil
+	}
+}
+
+// replaceInBuildConstraint returns a patch function that replaces each occurrence of the expression old in the
+// //go:build constraint of a file with the expression replacement. The file must have a constraint with old.
+func replaceInBuildConstraint(old string, replacement string) func(content []byte) ([]byte, error) {
+	replacementExpr := lo.Must(constraint.Parse("//go:build " + replacement))
+	return func(content []byte) ([]byte, error) {
+		lines := bytes.SplitAfter(content, []byte("\n"))
+		for idx, line := range lines {
+			text := string(bytes.TrimSpace(line))
+			if bytes.HasPrefix(line, []byte("package ")) {
+				break
+			}
+			if !constraint.IsGoBuild(text) {
+				continue
+			}
+			expr, err := constraint.Parse(text)
+			if err != nil {
+				return nil, merry.Wrap(err)
+			}
+			patched, count := replaceExpr(expr, old, replacementExpr)
+			if count == 0 {
+				return nil, merry.Errorf("build constraint %q doesn't contain %s", text, old)
+			}
+			lines[idx] = []byte("//go:build " + patched.String() + "\n")
+			return bytes.Join(lines, nil), nil
+		}
+		return nil, merry.New("//go:build constraint not found")
+	}
+}
+
+// replaceExpr returns expr with each subexpression equal to old, e.g. !no_base, replaced by replacement,
+// and the number of replacements
+func replaceExpr(expr constraint.Expr, old string, replacement constraint.Expr) (constraint.Expr, int) {
+	if expr.String() == old {
+		return replacement, 1
+	}
+	switch e := expr.(type) {
+	case *constraint.AndExpr:
+		x, xCount := replaceExpr(e.X, old, replacement)
+		y, yCount := replaceExpr(e.Y, old, replacement)
+		return &constraint.AndExpr{X: x, Y: y}, xCount + yCount
+	case *constraint.OrExpr:
+		x, xCount := replaceExpr(e.X, old, replacement)
+		y, yCount := replaceExpr(e.Y, old, replacement)
+		return &constraint.OrExpr{X: x, Y: y}, xCount + yCount
+	case *constraint.NotExpr:
+		x, count := replaceExpr(e.X, old, replacement)
+		return &constraint.NotExpr{X: x}, count
+	default:
+		return expr, 0
+	}
+}
+
+// applyUsqlPatch applies the patch to the downloaded usql code. If the code is not what the patch expects,
+// the error names the patch and the usql version.
+func (i Input) applyUsqlPatch(patch usqlPatch, usqlVersion string) error {
+	path := filepath.Join(i.WorkingDir, patch.RelPath)
+	content, err := os.ReadFile(path)
+	if err == nil {
+		content, err = patch.apply(content)
+	}
+	if err != nil {
+		return merry.Prependf(err, "unsupported usql version %s: patch %q of %s didn't apply", usqlVersion, patch.Name, patch.RelPath)
+	}
+	return merry.Wrap(os.WriteFile(path, content, fileMode))
+}
+
+func (p usqlPatch) planned() PlannedPatch {
+	return PlannedPatch{File: p.RelPath, Before: p.Before, After: p.After}
+}
@@ -0,0 +1,93 @@
+package gen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// usqlTestFiles contain the parts of usql files that usqlgen patches, as in usql v0.19
+var usqlTestFiles = map[string]string{
+	"main.go": `// Command usql is the universal command-line interface for SQL databases.
+package main
+
+import "os"
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int { return 0 }
+`,
+	filepath.Join("internal", "sqlite3.go"): `//go:build (!no_base || sqlite3) && !no_sqlite3
+
+package internal
+
+import _ "github.com/xo/usql/drivers/sqlite3" // SQLite3 driver
+`,
+	filepath.Join("internal", "moderncsqlite.go"): `//go:build (all || most || moderncsqlite) && !no_moderncsqlite
+
+package internal
+
+import _ "github.com/xo/usql/drivers/moderncsqlite" // ModernC SQLite driver
+`,
+}
+
+func writeUsqlTestFiles(t *testing.T, overrides map[string]string) string {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "internal"), fileMode))
+	for name, content := range usqlTestFiles {
+		if override, ok := overrides[name]; ok {
+			content = override
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), fileMode))
+	}
+	return dir
+}
+
+func readUsqlTestFile(t *testing.T, dir string, name string) string {
+	content, err := os.ReadFile(filepath.Join(dir, name))
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestInput_UsqlPatches(t *testing.T) {
+	t.Run("supported", func(t *testing.T) {
+		inp := Input{WorkingDir: writeUsqlTestFiles(t, nil)}
+		require.NoError(t, inp.applyUsqlPatch(mainPatch, "v0.19.14"))
+		require.NoError(t, inp.adjustCgoTags("v0.19.14"))
+
+		require.Contains(t, readUsqlTestFile(t, inp.WorkingDir, "main.go"), "func origMain() {\n\tos.Exit(run())\n}")
+		require.Contains(t, readUsqlTestFile(t, inp.WorkingDir, filepath.Join("internal", "sqlite3.go")),
+			"//go:build ((!no_base && cgo) || sqlite3) && !no_sqlite3\n\npackage internal\n")
+		require.Contains(t, readUsqlTestFile(t, inp.WorkingDir, filepath.Join("internal", "moderncsqlite.go")),
+			"//go:build (all || most || (!cgo && !no_base && !no_sqlite3) || moderncsqlite) && !no_moderncsqlite\n")
+	})
+
+	unsupported := map[string]map[string]string{
+		`patch "rename main" of main.go didn't apply: func main not found`: {
+			"main.go": "package main\n\nfunc Main() {}\n",
+		},
+		`patch "rename main" of main.go didn't apply: func origMain is already declared`: {
+			"main.go": "package main\n\nfunc main() { origMain() }\n\nfunc origMain() {}\n",
+		},
+		`patch "require cgo for sqlite3" of internal/sqlite3.go didn't apply: build constraint "//go:build sqlite3" doesn't contain !no_base`: {
+			filepath.Join("internal", "sqlite3.go"): "//go:build sqlite3\n\npackage internal\n",
+		},
+		`patch "use moderncsqlite without cgo" of internal/moderncsqlite.go didn't apply: //go:build constraint not found`: {
+			filepath.Join("internal", "moderncsqlite.go"): "package internal\n",
+		},
+	}
+	for expected, overrides := range unsupported {
+		t.Run(expected, func(t *testing.T) {
+			inp := Input{WorkingDir: writeUsqlTestFiles(t, overrides)}
+			err := inp.applyUsqlPatch(mainPatch, "v0.20.0")
+			if err == nil {
+				err = inp.adjustCgoTags("v0.20.0")
+			}
+			require.ErrorContains(t, err, "unsupported usql version v0.20.0: "+expected)
+		})
+	}
+}
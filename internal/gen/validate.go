@@ -0,0 +1,280 @@
+package gen
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ansel1/merry/v2"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// Replace is a parsed replace directive, given in the format of 'go mod edit -replace'
+type Replace struct {
+	OldPath    string
+	OldVersion string
+	NewPath    string
+	NewVersion string
+}
+
+// IsLocal returns true if the replacement is a local directory as opposed to a module
+func (r Replace) IsLocal() bool {
+	return r.NewVersion == "" && modfile.IsDirectoryPath(r.NewPath)
+}
+
+// String formats the replace in the format of 'go mod edit -replace'
+func (r Replace) String() string {
+	return joinPathVersion(r.OldPath, r.OldVersion) + "=" + joinPathVersion(r.NewPath, r.NewVersion)
+}
+
+func joinPathVersion(path string, version string) string {
+	if version == "" {
+		return path
+	}
+	return path + "@" + version
+}
+
+// ParseReplace parses a replace spec old[@v]=new[@v] the same way 'go mod edit -replace' does.
+// Relative local replacement paths are converted to absolute paths, since the generated module
+// is in a different directory.
+func ParseReplace(spec string) (Replace, error) {
+	var r Replace
+	before, after, found := strings.Cut(spec, "=")
+	if !found {
+		return r, merry.Errorf("invalid --replace %q: expected format old[@v]=new[@v]", spec)
+	}
+	before, after = strings.TrimSpace(before), strings.TrimSpace(after)
+	if strings.HasPrefix(after, ">") {
+		return r, merry.Errorf("invalid --replace %q: separator between old and new is =, not =>", spec)
+	}
+
+	var err error
+	r.OldPath, r.OldVersion, err = parsePathVersion(before)
+	if err != nil {
+		return r, merry.Prependf(err, "invalid --replace %q: old", spec)
+	}
+
+	if modfile.IsDirectoryPath(after) {
+		r.NewPath, err = filepath.Abs(after)
+		if err != nil {
+			return r, merry.Prependf(err, "invalid --replace %q", spec)
+		}
+		_, err = os.Stat(filepath.Join(r.NewPath, "go.mod"))
+		if err != nil {
+			return r, merry.Errorf("invalid --replace %q: local replacement %s must be a directory with go.mod file: %w", spec, r.NewPath, err)
+		}
+		return r, nil
+	}
+
+	r.NewPath, r.NewVersion, err = parsePathVersion(after)
+	if err != nil {
+		return r, merry.Prependf(err, "invalid --replace %q: new", spec)
+	}
+	if r.NewVersion == "" {
+		return r, merry.Errorf("invalid --replace %q: replacement module must have a version or be a local directory", spec)
+	}
+	return r, nil
+}
+
+// parsePathVersion parses path[@version], where version may be any query accepted by go get e.g. a branch name
+func parsePathVersion(arg string) (string, string, error) {
+	path, version, found := strings.Cut(arg, "@")
+	path, version = strings.TrimSpace(path), strings.TrimSpace(version)
+	if err := module.CheckImportPath(path); err != nil {
+		return path, version, merry.Wrap(err)
+	}
+	if found && (version == "" || modfile.MustQuote(version)) {
+		return path, version, merry.Errorf("version %q is invalid", version)
+	}
+	return path, version, nil
+}
+
+// parseExclude parses an exclude spec module@version. Unlike --get, the version must be a
+// canonical semantic version, because go.mod doesn't allow queries in exclude directives.
+func parseExclude(spec string) (module.Version, error) {
+	path, version, err := parsePathVersion(spec)
+	if err != nil {
+		return module.Version{}, merry.Prependf(err, "invalid --exclude %q", spec)
+	}
+	if version == "" {
+		return module.Version{}, merry.Errorf("invalid --exclude %q: expected format module@version", spec)
+	}
+	e := module.Version{Path: path, Version: version}
+	if err = module.Check(path, version); err != nil {
+		return e, merry.Prependf(err, "invalid --exclude %q", spec)
+	}
+	return e, nil
+}
+
+// Validate checks the input for errors that can be detected before any code is downloaded or generated
+func (i Input) Validate() error {
+	if err := i.validateModules(); err != nil {
+		return err
+	}
+	if err := i.validateDriverConfigs(); err != nil {
+		return err
+	}
+	for _, patchFile := range i.Patches {
+		if _, err := readPatchFile(patchFile); err != nil {
+			return err
+		}
+	}
+	for _, file := range i.InitFiles {
+		if err := validateInitFile(file); err != nil {
+			return err
+		}
+	}
+	if len(i.InitSnippets) > 0 {
+		if _, err := parseInitSnippets(i.InitSnippets); err != nil {
+			return err
+		}
+	}
+	if err := i.validateSettings(); err != nil {
+		return err
+	}
+	if i.MainTemplate != "" {
+		if _, err := i.mainTemplate(); err != nil {
+			return err
+		}
+	}
+	if i.PGOProfile != "" {
+		if stat, err := os.Stat(i.PGOProfile); err != nil || stat.IsDir() {
+			return merry.Errorf("invalid --pgo %q: must be a CPU profile file", i.PGOProfile)
+		}
+	}
+	return nil
+}
+
+// validateModules checks the flags that select the usql module and change the generated go.mod
+func (i Input) validateModules() error {
+	for _, imp := range i.Imports {
+		if err := module.CheckImportPath(imp); err != nil {
+			return merry.Prependf(err, "invalid --import %q", imp)
+		}
+	}
+
+	if i.USQLModule != "" {
+		if err := module.CheckPath(i.USQLModule); err != nil {
+			return merry.Prependf(err, "invalid --usql-module %q", i.USQLModule)
+		}
+	}
+	if i.USQLVersion != "" && modfile.MustQuote(i.USQLVersion) {
+		return merry.Errorf("invalid --usql-version %q", i.USQLVersion)
+	}
+
+	// gets contains the --get value for each module path
+	gets := make(map[string]string, len(i.Gets))
+	for _, gs := range i.Gets {
+		path, _, err := parsePathVersion(gs)
+		if err != nil {
+			return merry.Prependf(err, "invalid --get %q", gs)
+		}
+		if prev, ok := gets[path]; ok {
+			return merry.Errorf("conflicting --get %q and --get %q", prev, gs)
+		}
+		gets[path] = gs
+	}
+
+	// replaces contains the --replace value for each replaced module path and version
+	replaces := make(map[string]string, len(i.Replaces))
+	for _, rs := range i.Replaces {
+		r, err := ParseReplace(rs)
+		if err != nil {
+			return err
+		}
+		if gs, ok := gets[r.OldPath]; ok {
+			return merry.Errorf("conflicting --replace %q and --get %q: the module can either be replaced or updated", rs, gs)
+		}
+		old := joinPathVersion(r.OldPath, r.OldVersion)
+		if prev, ok := replaces[old]; ok {
+			return merry.Errorf("conflicting --replace %q and --replace %q", prev, rs)
+		}
+		replaces[old] = rs
+	}
+
+	for _, es := range i.Excludes {
+		if _, err := parseExclude(es); err != nil {
+			return err
+		}
+	}
+	if i.Toolchain != "" && !modfile.ToolchainRE.MatchString(i.Toolchain) {
+		return merry.Errorf("invalid --toolchain %q: expected a toolchain name like go1.23.4 or default", i.Toolchain)
+	}
+	return nil
+}
+
+// validateDriverConfigs checks the flags that configure imported drivers
+func (i Input) validateDriverConfigs() error {
+	likes := make(map[string]string, len(i.Likes))
+	for _, spec := range i.Likes {
+		driver, _, err := parseLike(spec)
+		if err != nil {
+			return err
+		}
+		if _, ok := likes[driver]; ok {
+			return merry.Errorf("invalid --like %q: driver %s is configured more than once", spec, driver)
+		}
+		likes[driver] = spec
+	}
+	dialects := make(map[string]string, len(i.Dialects))
+	for _, spec := range i.Dialects {
+		driver, _, err := ParseDialect(spec)
+		if err != nil {
+			return err
+		}
+		if prev, ok := dialects[driver]; ok {
+			return merry.Errorf("conflicting --dialect %q and --dialect %q: combine the settings of a driver in one value", prev, spec)
+		}
+		dialects[driver] = spec
+	}
+	versionQueries := make(map[string]string, len(i.VersionQueries))
+	for _, spec := range i.VersionQueries {
+		driver, _, err := parseVersionQuery(spec)
+		if err != nil {
+			return err
+		}
+		if _, ok := versionQueries[driver]; ok {
+			return merry.Errorf("invalid --version-query %q: driver %s is configured more than once", spec, driver)
+		}
+		versionQueries[driver] = spec
+	}
+	for _, spec := range i.Rewrites {
+		if _, _, err := ParseRewrite(spec); err != nil {
+			return err
+		}
+	}
+	for _, spec := range i.Classifications {
+		if _, _, err := ParseClassification(spec); err != nil {
+			return err
+		}
+	}
+	processors := make(map[string]string, len(i.Processors))
+	for _, spec := range i.Processors {
+		p, err := ParseProcessor(spec)
+		if err != nil {
+			return err
+		}
+		if prev, ok := processors[p.Driver]; ok {
+			return merry.Errorf("conflicting --processor %q and --processor %q", prev, spec)
+		}
+		processors[p.Driver] = spec
+	}
+	connectors := make(map[string]string, len(i.Connectors))
+	for _, spec := range i.Connectors {
+		c, err := ParseConnector(spec)
+		if err != nil {
+			return err
+		}
+		if prev, ok := connectors[c.Name]; ok {
+			return merry.Errorf("conflicting --connector %q and --connector %q", prev, spec)
+		}
+		connectors[c.Name] = spec
+	}
+	driverConfigs := [][]string{i.Likes, i.Dialects, i.VersionQueries, i.Rewrites, i.Classifications, i.Processors}
+	if slices.ContainsFunc(driverConfigs, func(specs []string) bool { return len(specs) > 0 }) && len(i.Imports) == 0 && len(i.Connectors) == 0 {
+		return merry.New("--like, --dialect, --version-query, --rewrite, --classify and --processor require --import of the package that registers the driver or --connector")
+	}
+	return nil
+}
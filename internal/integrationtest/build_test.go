@@ -35,7 +35,7 @@ func TestVersion(t *testing.T) {
 	cmds.BuildCmd.USQLVersion = testVersion
 	cmds.BuildCmd.Globals.PassthroughArgs = []string{"-tags", "no_base"}
 
-	err := cmds.BuildCmd.Action(nil)
+	err := cmds.BuildCmd.Action(t.Context(), nil)
 	require.NoError(t, err)
 
 	cmd := exec.Command("./usql", "--version")
@@ -36,7 +36,7 @@ func CheckGenAll(t *testing.T, inp gen.Input, dsn string, command string, tags .
 	tmpDir := t.TempDir()
 	inp.WorkingDir = tmpDir
 
-	err := inp.All()
+	err := inp.All(t.Context())
 	require.NoError(t, err)
 
 	output := RunGeneratedUsql(t, dsn, command, tmpDir, tags...)
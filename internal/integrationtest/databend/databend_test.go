@@ -58,7 +58,7 @@ func TestDatabend(t *testing.T) {
 	tmpDir := t.TempDir()
 	inp.WorkingDir = tmpDir
 
-	err := inp.All()
+	err := inp.All(t.Context())
 	require.NoError(t, err)
 
 	t.Run("basic query", func(t *testing.T) {
@@ -28,7 +28,7 @@ func TestSqlite_NoCgo(t *testing.T) {
 		tmpDir := t.TempDir()
 		inp.WorkingDir = tmpDir
 
-		err := inp.All()
+		err := inp.All(t.Context())
 		require.NoError(t, err)
 
 		_, err = it.RunGeneratedUsqlE("", `\drivers`, tmpDir, noCgoEnv, tag)
@@ -49,7 +49,7 @@ func TestSqlite_NoCgo(t *testing.T) {
 				t.Log(tmpDir)
 				inp.WorkingDir = tmpDir
 
-				err := inp.All()
+				err := inp.All(t.Context())
 				require.NoError(t, err)
 
 				_, err = it.RunGeneratedUsqlE("", `\drivers`, tmpDir, noCgoEnv, tag)
@@ -70,7 +70,7 @@ func TestSqlite_NoCgo(t *testing.T) {
 		tmpDir := t.TempDir()
 		inp.WorkingDir = tmpDir
 
-		err := inp.All()
+		err := inp.All(t.Context())
 		require.NoError(t, err)
 
 		_, err = it.RunGeneratedUsqlE("", `\drivers`, tmpDir, noCgoEnv, "base")
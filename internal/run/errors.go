@@ -0,0 +1,111 @@
+package run
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Kind identifies a common, recognizable failure of the go tool
+type Kind string
+
+const (
+	ModulePathMismatch Kind = "module path mismatch"
+	MissingPackage     Kind = "missing package"
+	VersionNotFound    Kind = "version not found"
+	ChecksumMismatch   Kind = "checksum mismatch"
+	CgoCompiler        Kind = "C compiler not found"
+	DuplicateDriver    Kind = "duplicate driver registration"
+)
+
+// GoError is a go tool failure, classified by matching known patterns in its output.
+// It contains a short explanation and a suggestion for the user, typically a usqlgen flag.
+type GoError struct {
+	Kind        Kind
+	Explanation string
+	Suggestion  string
+}
+
+func (e *GoError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Kind, e.Explanation)
+}
+
+type classifier struct {
+	re    *regexp.Regexp
+	build func(match []string) *GoError
+}
+
+var classifiers = []classifier{
+	{
+		re: regexp.MustCompile(`module declares its path as: (\S+)\s+but was required as: (\S+)`),
+		build: func(m []string) *GoError {
+			return &GoError{
+				Kind:        ModulePathMismatch,
+				Explanation: fmt.Sprintf("module %s declares its path as %s so it can't be imported directly", m[2], m[1]),
+				Suggestion:  fmt.Sprintf(`use it as a replacement of the original instead e.g. --replace "%s=%s@<version>"`, m[1], m[2]),
+			}
+		},
+	},
+	{
+		re: regexp.MustCompile(`(?:no required module provides package|cannot find module providing package|does not contain package) (\S+?);?\s`),
+		build: func(m []string) *GoError {
+			return &GoError{
+				Kind:        MissingPackage,
+				Explanation: fmt.Sprintf("package %s was not found in any module", m[1]),
+				Suggestion:  "check the --import value for typos, or add the module providing it with --get module@version",
+			}
+		},
+	},
+	{
+		re: regexp.MustCompile(`(\S+?):?\s+(?:invalid version: unknown revision \S+|unknown revision \S+|no matching versions for query "[^"]*"|reading \S+: 404 Not Found)`),
+		build: func(m []string) *GoError {
+			return &GoError{
+				Kind:        VersionNotFound,
+				Explanation: fmt.Sprintf("requested version of %s doesn't exist", strings.TrimPrefix(m[1], "go: ")),
+				Suggestion:  "check the versions given to --usql-version, --get and --replace",
+			}
+		},
+	},
+	{
+		re: regexp.MustCompile(`verifying (\S+): checksum mismatch`),
+		build: func(m []string) *GoError {
+			return &GoError{
+				Kind:        ChecksumMismatch,
+				Explanation: fmt.Sprintf("downloaded code of %s doesn't match its recorded checksum", m[1]),
+				Suggestion:  "run 'go clean -modcache' and retry; for private modules, set GOPRIVATE",
+			}
+		},
+	},
+	{
+		// the second alternative only matches C compilers, since other tools, like git during go get, fail the same way
+		re: regexp.MustCompile(`cgo: C compiler "([^"]+)" not found|exec: "([^"]*(?:gcc|clang|cc)[^"/]*)": executable file not found in \$PATH`),
+		build: func(m []string) *GoError {
+			return &GoError{
+				Kind:        CgoCompiler,
+				Explanation: fmt.Sprintf("C compiler %s, required by CGO, is not available", m[1]+m[2]),
+				Suggestion:  "add --static to build without CGO, or exclude the drivers that need CGO with '-- -tags no_xxx'",
+			}
+		},
+	},
+	{
+		re: regexp.MustCompile(`sql: Register called twice for driver (\S+)`),
+		build: func(m []string) *GoError {
+			return &GoError{
+				Kind:        DuplicateDriver,
+				Explanation: fmt.Sprintf("two packages register a database/sql driver named %s", m[1]),
+				Suggestion:  fmt.Sprintf("exclude the built-in usql driver by adding '-- -tags no_%s'", m[1]),
+			}
+		},
+	},
+}
+
+// Classify returns the GoError matching the given go tool output,
+// or nil if the output doesn't match any known failure.
+func Classify(output string) *GoError {
+	for _, c := range classifiers {
+		if m := c.re.FindStringSubmatch(output); m != nil {
+			return c.build(m)
+		}
+	}
+	return nil
+}
@@ -3,19 +3,25 @@ package run
 
 import (
 	"bytes"
+	"context"
 	"io"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"time"
 
 	"github.com/ansel1/merry/v2"
+	"github.com/samber/lo"
 )
 
-func Go(workingDir string, goCmd ...string) error {
-	return GoBin(workingDir, nil, FindGo(), goCmd...)
+func Go(ctx context.Context, workingDir string, goCmd ...string) error {
+	return GoBin(ctx, workingDir, nil, FindGo(), goCmd...)
 }
 
+// waitDelay bounds the wait for output of a stopped command
+const waitDelay = 5 * time.Second
+
 func FindGo() string {
 	goBin := "go"
 	goroot := os.Getenv("GOROOT")
@@ -26,14 +32,54 @@ func FindGo() string {
 }
 
 // GoBin runs a go or a go-like command with a custom binary, capturing error output in the error result
-func GoBin(workingDir string, addEnv []string, goBin string, goCmd ...string) error {
-	log.Printf("running with addEnv %v %s %+v", addEnv, goBin, goCmd)
-	cmd := exec.Command(goBin, goCmd...)
-	cmd.Dir = workingDir
-	cmd.Stdout = os.Stdout
+func GoBin(ctx context.Context, workingDir string, addEnv []string, goBin string, goCmd ...string) error {
+	return Command{
+		Dir:    workingDir,
+		AddEnv: addEnv,
+		GoBin:  goBin,
+		Args:   goCmd,
+	}.Run(ctx)
+}
+
+// Command is a go or a go-like command invocation
+type Command struct {
+	Dir    string
+	AddEnv []string
+	GoBin  string
+	Args   []string
+
+	// Stdout receives the standard output of the command if set. Otherwise, standard output is logged.
+	Stdout io.Writer
+}
+
+// Run runs the command, capturing error output in the error result.
+// If the context is done, the command is stopped together with all processes it started.
+func (c Command) Run(ctx context.Context) error {
+	slog.Debug("running go command", "dir", c.Dir, "addEnv", c.AddEnv, "bin", c.GoBin, "args", c.Args)
+	cmd := exec.CommandContext(ctx, c.GoBin, c.Args...)
+	// go starts compilers, linkers, VCS tools, etc. as child processes
+	setProcessGroup(cmd)
+	cmd.WaitDelay = waitDelay
+	cmd.Dir = c.Dir
+	cmd.Stdout = lo.CoalesceOrEmpty(c.Stdout, LogOutput(c.GoBin))
 	var buf bytes.Buffer
-	cmd.Stderr = io.MultiWriter(&buf, os.Stderr)
-	cmd.Env = append(os.Environ(), addEnv...)
+	cmd.Stderr = io.MultiWriter(&buf, LogOutput(c.GoBin))
+	cmd.Env = append(os.Environ(), c.AddEnv...)
 	err := cmd.Run()
-	return merry.Wrap(err, merry.AppendMessagef("while running %s %+v with output \n%s", goBin, goCmd, &buf))
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return merry.Wrap(context.Cause(ctx), merry.AppendMessagef("while running %s %+v", c.GoBin, c.Args))
+	}
+	return WrapFailure(err, buf.String(), merry.AppendMessagef("while running %s %+v with output \n%s", c.GoBin, c.Args, &buf))
+}
+
+// WrapFailure wraps an error from a go tool command with the given wrappers. If the command output matches
+// a known failure, the respective GoError is attached as cause and can be retrieved with errors.As
+func WrapFailure(err error, output string, wrappers ...merry.Wrapper) error {
+	if goErr := Classify(output); goErr != nil {
+		wrappers = append(wrappers, merry.WithCause(goErr))
+	}
+	return merry.WrapSkipping(err, 1, wrappers...)
 }
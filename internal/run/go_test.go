@@ -1,7 +1,11 @@
 package run_test
 
 import (
+	"context"
+	"errors"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/sclgo/usqlgen/internal/run"
 	"github.com/stretchr/testify/require"
@@ -9,7 +13,93 @@ import (
 
 func TestGoBin(t *testing.T) {
 	t.Run("error", func(t *testing.T) {
-		err := run.GoBin(".", nil, "test")
+		err := run.GoBin(t.Context(), ".", nil, "test")
 		require.Error(t, err)
 	})
+
+	t.Run("timeout", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("requires sleep command")
+		}
+		ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err := run.GoBin(ctx, ".", nil, "sh", "-c", "sleep 10 & sleep 10")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Less(t, time.Since(start), 5*time.Second)
+	})
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		output string
+		kind   run.Kind
+		hint   string
+	}{
+		{
+			output: "go: github.com/dlapko/go-mssqldb@v1.0.0: parsing go.mod:\n\tmodule declares its path as: github.com/microsoft/go-mssqldb\n\t        but was required as: github.com/dlapko/go-mssqldb",
+			kind:   run.ModulePathMismatch,
+			hint:   `--replace "github.com/microsoft/go-mssqldb=github.com/dlapko/go-mssqldb@<version>"`,
+		},
+		{
+			output: "new_main.go:20:8: no required module provides package github.com/foo/bar; to add it:\n",
+			kind:   run.MissingPackage,
+			hint:   "--get",
+		},
+		{
+			output: "go: github.com/xo/usql@v9.9.9: invalid version: unknown revision v9.9.9",
+			kind:   run.VersionNotFound,
+			hint:   "--usql-version",
+		},
+		{
+			output: "go: github.com/foo/bar@v1.0.0: reading https://proxy.golang.org/github.com/foo/bar/@v/v1.0.0.info: 404 Not Found",
+			kind:   run.VersionNotFound,
+			hint:   "--get",
+		},
+		{
+			output: "verifying github.com/foo/bar@v1.0.0: checksum mismatch\n\tdownloaded: h1:abc",
+			kind:   run.ChecksumMismatch,
+			hint:   "go clean -modcache",
+		},
+		{
+			output: "# runtime/cgo\ncgo: C compiler \"gcc\" not found: exec: \"gcc\": executable file not found in $PATH",
+			kind:   run.CgoCompiler,
+			hint:   "--static",
+		},
+		{
+			output: "# runtime/cgo\nexec: \"x86_64-linux-musl-gcc\": executable file not found in $PATH",
+			kind:   run.CgoCompiler,
+			hint:   "--static",
+		},
+		{
+			output: "panic: sql: Register called twice for driver clickhouse",
+			kind:   run.DuplicateDriver,
+			hint:   "no_clickhouse",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.kind), func(t *testing.T) {
+			goErr := run.Classify(tt.output)
+			require.NotNil(t, goErr)
+			require.Equal(t, tt.kind, goErr.Kind)
+			require.Contains(t, goErr.Suggestion, tt.hint)
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		require.Nil(t, run.Classify("something else failed"))
+	})
+
+	t.Run("missing git", func(t *testing.T) {
+		output := "go: github.com/foo/bar@v1.0.0: git init --bare in /root/go/pkg/mod/cache/vcs/abc: exec: \"git\": executable file not found in $PATH"
+		require.Nil(t, run.Classify(output))
+	})
+}
+
+func TestWrapFailure(t *testing.T) {
+	err := run.WrapFailure(errors.New("exit status 1"), "panic: sql: Register called twice for driver mysql")
+	var goErr *run.GoError
+	require.ErrorAs(t, err, &goErr)
+	require.Equal(t, run.DuplicateDriver, goErr.Kind)
+	require.ErrorContains(t, err, "exit status 1")
 }
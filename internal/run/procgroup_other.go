@@ -0,0 +1,8 @@
+//go:build !unix && !windows
+
+package run
+
+import "os/exec"
+
+// setProcessGroup keeps the default behaviour of exec.CommandContext, killing only the command process
+func setProcessGroup(*exec.Cmd) {}
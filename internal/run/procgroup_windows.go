@@ -0,0 +1,21 @@
+//go:build windows
+
+package run
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// setProcessGroup makes cancellation kill the whole process tree of the command with taskkill /T,
+// so compilers and linkers, started by go, don't keep running
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.Cancel = func() error {
+		err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+		if err != nil {
+			// e.g. taskkill is not available - at least the command itself is killed
+			return cmd.Process.Kill()
+		}
+		return nil
+	}
+}
@@ -0,0 +1,270 @@
+package run
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	ttyRefreshInterval   = 200 * time.Millisecond
+	plainRefreshInterval = 15 * time.Second
+)
+
+// activeProgress receives notifications from Step, if set
+var activeProgress atomic.Pointer[Progress]
+
+// Progress displays the current step of the usqlgen pipeline and its elapsed time, and during go build,
+// the number of compiled packages. When stopped, it prints a summary of step durations.
+// On a terminal, the display is a single line, redrawn in place. Otherwise, progress is
+// reported with periodic single-line updates.
+type Progress struct {
+	out      io.Writer
+	tty      bool
+	interval time.Duration
+
+	mu        sync.Mutex
+	start     time.Time
+	step      string
+	stepStart time.Time
+	packages  int
+	timings   []stepTiming
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type stepTiming struct {
+	name     string
+	duration time.Duration
+	packages int
+}
+
+// NewProgress creates a Progress writing to out. If plain is true, the terminal display is never used.
+func NewProgress(out io.Writer, plain bool) *Progress {
+	if out == nil {
+		out = os.Stderr
+	}
+	p := &Progress{
+		out:      out,
+		tty:      !plain && isTerminal(out),
+		interval: plainRefreshInterval,
+	}
+	if p.tty {
+		p.interval = ttyRefreshInterval
+	}
+	return p
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// Start starts displaying progress of steps executed with Step
+func (p *Progress) Start() {
+	p.mu.Lock()
+	p.start = time.Now()
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	p.mu.Unlock()
+	activeProgress.Store(p)
+	go p.loop()
+}
+
+// Stop stops the display and prints the summary of step durations
+func (p *Progress) Stop() {
+	activeProgress.CompareAndSwap(p, nil)
+	close(p.stop)
+	<-p.done
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clearLine()
+	p.writeSummary()
+}
+
+func (p *Progress) loop() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			p.writeStatus()
+			p.mu.Unlock()
+		}
+	}
+}
+
+func (p *Progress) stepStarted(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.step = name
+	p.stepStart = time.Now()
+	p.packages = 0
+}
+
+func (p *Progress) stepFinished(name string, duration time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.timings = append(p.timings, stepTiming{name: name, duration: duration, packages: p.packages})
+	p.step = ""
+	// clears the status line so logs about the finished step start on an empty line
+	p.clearLine()
+}
+
+func (p *Progress) packageCompiled() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.packages++
+}
+
+func (p *Progress) status() string {
+	if p.step == "" {
+		return ""
+	}
+	now := time.Now()
+	status := fmt.Sprintf("%s: %s (total %s)", p.step, roundDuration(now.Sub(p.stepStart)), roundDuration(now.Sub(p.start)))
+	if p.packages > 0 {
+		status += fmt.Sprintf(", %d packages compiled", p.packages)
+	}
+	return status
+}
+
+func (p *Progress) writeStatus() {
+	status := p.status()
+	if status == "" {
+		return
+	}
+	if p.tty {
+		_, _ = fmt.Fprint(p.out, "\r\033[K", status)
+	} else {
+		_, _ = fmt.Fprintln(p.out, "usqlgen progress:", status)
+	}
+}
+
+func (p *Progress) clearLine() {
+	if p.tty {
+		_, _ = fmt.Fprint(p.out, "\r\033[K")
+	}
+}
+
+func (p *Progress) writeSummary() {
+	if len(p.timings) == 0 {
+		return
+	}
+	_, _ = fmt.Fprintf(p.out, "usqlgen finished in %s:\n", roundDuration(time.Since(p.start)))
+	tw := tabwriter.NewWriter(p.out, 0, 0, 2, ' ', 0)
+	for _, t := range p.timings {
+		line := fmt.Sprintf("  %s\t%s", t.name, roundDuration(t.duration))
+		if t.packages > 0 {
+			line += fmt.Sprintf("\t%d packages compiled", t.packages)
+		}
+		_, _ = fmt.Fprintln(tw, line)
+	}
+	_ = tw.Flush()
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	return d.Round(100 * time.Millisecond)
+}
+
+// BuildTrace parses the output of go build or go install, executed with -json -x.
+// It counts compiled packages and collects compiler output of packages that failed to build.
+type BuildTrace struct {
+	progress *Progress
+
+	mu       sync.Mutex
+	partial  bytes.Buffer
+	compiled map[string]bool
+	// output holds compiler output per package, starting with the "# package" header
+	output map[string]*strings.Builder
+	failed []string
+}
+
+// buildEvent is an event in the output of go build -json
+type buildEvent struct {
+	ImportPath string
+	Action     string
+	Output     string
+}
+
+// BuildTrace creates a writer for the standard output of go build -json -x that updates this Progress
+func (p *Progress) BuildTrace() *BuildTrace {
+	return &BuildTrace{
+		progress: p,
+		compiled: make(map[string]bool),
+		output:   make(map[string]*strings.Builder),
+	}
+}
+
+func (t *BuildTrace) Write(data []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.partial.Write(data)
+	for {
+		line, err := t.partial.ReadBytes('\n')
+		if err != nil {
+			// incomplete line - keep it until the rest arrives
+			t.partial.Write(line)
+			break
+		}
+		t.handleLine(line)
+	}
+	return len(data), nil
+}
+
+func (t *BuildTrace) handleLine(line []byte) {
+	var event buildEvent
+	if json.Unmarshal(line, &event) != nil {
+		return
+	}
+	switch event.Action {
+	case "build-fail":
+		t.failed = append(t.failed, event.ImportPath)
+	case "build-output":
+		if isCompileCommand(event.Output) && !t.compiled[event.ImportPath] {
+			t.compiled[event.ImportPath] = true
+			t.progress.packageCompiled()
+		}
+		if event.Output == "# "+event.ImportPath+"\n" {
+			t.output[event.ImportPath] = &strings.Builder{}
+		}
+		if out, ok := t.output[event.ImportPath]; ok {
+			out.WriteString(event.Output)
+		}
+	}
+}
+
+func isCompileCommand(output string) bool {
+	fields := strings.Fields(output)
+	return len(fields) > 0 && strings.HasSuffix(strings.TrimSuffix(fields[0], ".exe"), "compile") && strings.Contains(output, " -p ")
+}
+
+// FailureOutput returns the compiler output of all packages that failed to build
+func (t *BuildTrace) FailureOutput() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var sb strings.Builder
+	for _, pkg := range t.failed {
+		if out, ok := t.output[pkg]; ok {
+			sb.WriteString(out.String())
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,39 @@
+package run_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sclgo/usqlgen/internal/run"
+	"github.com/stretchr/testify/require"
+)
+
+const buildTraceOutput = `{"ImportPath":"","Action":"build-output","Output":"WORK=/tmp/go-build1\n"}
+{"ImportPath":"example.com/a","Action":"build-output","Output":"mkdir -p $WORK/b002/\n"}
+{"ImportPath":"example.com/a","Action":"build-output","Output":"/usr/local/go/pkg/tool/linux_amd64/compile -o $WORK/b002/_pkg_.a -p example.com/a -lang=go1.24 ./a.go\n"}
+{"ImportPath":"main","Action":"build-output","Output":"/usr/local/go/pkg/tool/linux_amd64/compile -o $WORK/b001/_pkg_.a -p main -lang=go1.24 ./main.go\n"}
+{"ImportPath":"main","Action":"build-output","Output":"# main\n"}
+{"ImportPath":"main","Action":"build-output","Output":"./main.go:3:14: undefined: x\n"}
+{"ImportPath":"main","Action":"build-fail"}
+`
+
+func TestProgress(t *testing.T) {
+	var buf bytes.Buffer
+	progress := run.NewProgress(&buf, true)
+	progress.Start()
+
+	trace := progress.BuildTrace()
+	err := run.Step("build", func() error {
+		// split writes to check partial lines are handled
+		_, err := trace.Write([]byte(buildTraceOutput[:50]))
+		require.NoError(t, err)
+		_, err = trace.Write([]byte(buildTraceOutput[50:]))
+		return err
+	})
+	require.NoError(t, err)
+	progress.Stop()
+
+	require.Equal(t, "# main\n./main.go:3:14: undefined: x\n", trace.FailureOutput())
+	require.Contains(t, buf.String(), "usqlgen finished in")
+	require.Contains(t, buf.String(), "2 packages compiled")
+}
@@ -0,0 +1,58 @@
+package run
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Step runs a named step of the usqlgen pipeline and logs its duration
+func Step(name string, f func() error) error {
+	slog.Debug("step started", "step", name)
+	progress := activeProgress.Load()
+	if progress != nil {
+		progress.stepStarted(name)
+	}
+	start := time.Now()
+	err := f()
+	duration := time.Since(start)
+	if progress != nil {
+		progress.stepFinished(name, duration)
+	}
+	if err != nil {
+		slog.Debug("step failed", "step", name, "duration", duration)
+		return err
+	}
+	slog.Info("step finished", "step", name, "duration", duration)
+	return nil
+}
+
+// LogOutput returns a writer that logs each line written to it at debug level.
+// It is used to route output of go tool commands to the usqlgen log.
+func LogOutput(source string) io.Writer {
+	return &lineLogger{source: source}
+}
+
+type lineLogger struct {
+	source string
+	mu     sync.Mutex
+	buf    bytes.Buffer
+}
+
+func (l *lineLogger) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf.Write(p)
+	for {
+		line, err := l.buf.ReadBytes('\n')
+		if err != nil {
+			// incomplete line - keep it until the rest arrives
+			l.buf.Write(line)
+			break
+		}
+		slog.Debug(string(bytes.TrimRight(line, "\r\n")), "source", l.source)
+	}
+	return len(p), nil
+}
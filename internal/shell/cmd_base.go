@@ -1,12 +1,66 @@
 package shell
 
 import (
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/ansel1/merry/v2"
+	"github.com/samber/lo"
+	"github.com/sclgo/usqlgen/internal/run"
 	"github.com/urfave/cli/v2"
 )
 
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
 type GlobalParams struct {
 	Verbose         bool
+	Quiet           bool
+	LogFormat       string
+	NoProgress      bool
 	PassthroughArgs []string
+
+	// Stdout receives command output like --dry-run plans; os.Stdout is used if nil
+	Stdout io.Writer
+	// Stderr receives logs and progress; os.Stderr is used if nil
+	Stderr io.Writer
+}
+
+// NewProgress creates the progress display for the generation and compilation pipeline,
+// or returns nil, if progress is disabled by the global flags
+func (g *GlobalParams) NewProgress() *run.Progress {
+	if g.NoProgress || g.Quiet || g.LogFormat == logFormatJSON {
+		return nil
+	}
+	// in verbose mode, the terminal display would be garbled by the debug logs
+	return run.NewProgress(g.Stderr, g.Verbose)
+}
+
+// NewLogger creates the logger for all usqlgen output, as configured by the global flags
+func (g *GlobalParams) NewLogger() (*slog.Logger, error) {
+	w := lo.CoalesceOrEmpty(g.Stderr, io.Writer(os.Stderr))
+	if g.Verbose && g.Quiet {
+		return nil, merry.New("--verbose and --quiet can't be used together")
+	}
+	level := slog.LevelInfo
+	if g.Verbose {
+		level = slog.LevelDebug
+	}
+	if g.Quiet {
+		level = slog.LevelWarn
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	switch g.LogFormat {
+	case "", logFormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case logFormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, merry.Errorf("unknown log format %q; use %s or %s", g.LogFormat, logFormatText, logFormatJSON)
+	}
 }
 
 type CommandBase struct {
@@ -21,5 +75,22 @@ func (c *CommandBase) MakeFlags() []cli.Flag {
 			Aliases:     []string{"v"},
 			Destination: &c.Globals.Verbose,
 		},
+		&cli.BoolFlag{
+			Name:        "quiet",
+			Usage:       "print only warnings and errors",
+			Aliases:     []string{"q"},
+			Destination: &c.Globals.Quiet,
+		},
+		&cli.BoolFlag{
+			Name:        "no-progress",
+			Usage:       "don't display progress of long-running steps and the final summary of step durations",
+			Destination: &c.Globals.NoProgress,
+		},
+		&cli.StringFlag{
+			Name:        "log-format",
+			Usage:       "format of usqlgen output: text or json",
+			Value:       logFormatText,
+			Destination: &c.Globals.LogFormat,
+		},
 	}
 }
@@ -0,0 +1,47 @@
+package shell
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlobalParams_NewLogger(t *testing.T) {
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger, err := (&GlobalParams{LogFormat: logFormatJSON, Stderr: &buf}).NewLogger()
+		require.NoError(t, err)
+		logger.Info("step finished", "step", "download")
+		logger.Debug("hidden")
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+		require.Equal(t, "download", entry["step"])
+	})
+
+	t.Run("quiet", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger, err := (&GlobalParams{Quiet: true, Stderr: &buf}).NewLogger()
+		require.NoError(t, err)
+		logger.Info("hidden")
+		require.Empty(t, buf.String())
+		logger.Warn("shown")
+		require.Contains(t, buf.String(), "shown")
+	})
+
+	t.Run("verbose", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger, err := (&GlobalParams{Verbose: true, Stderr: &buf}).NewLogger()
+		require.NoError(t, err)
+		logger.Debug("shown")
+		require.Contains(t, buf.String(), "shown")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := (&GlobalParams{Verbose: true, Quiet: true}).NewLogger()
+		require.Error(t, err)
+		_, err = (&GlobalParams{LogFormat: "xml"}).NewLogger()
+		require.ErrorContains(t, err, "xml")
+	})
+}
@@ -1,13 +1,18 @@
 package shell
 
 import (
+	"context"
 	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
 
 	"github.com/ansel1/merry/v2"
 	"github.com/murfffi/gorich/helperr"
+	"github.com/sclgo/usqlgen/internal/run"
+	"github.com/sclgo/usqlgen/internal/sign"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ssh"
 )
 
 type BuildCommand struct {
@@ -26,21 +31,39 @@ executable with name 'usql' will be created there;`,
 			Aliases:     []string{"o"},
 			Destination: &c.output,
 			Value:       ".",
+		},
+		&cli.StringFlag{
+			Name:        "sign-key",
+			Usage:       `path to an SSH or ed25519 private key; if set, a detached signature is written next to each produced executable, with suffix .sig`,
+			Destination: &c.signKey,
 		})
 }
 
 // Action executes the build command using the given stdout
-func (c *BuildCommand) Action(stdout io.Writer) error {
+func (c *BuildCommand) Action(ctx context.Context, stdout io.Writer) error {
 	if stdout == nil {
 		stdout = os.Stdout
 	}
 
+	var signer ssh.Signer
+	if c.signKey != "" && !c.DryRun {
+		if c.output == "-" {
+			return merry.New("--sign-key can't be used when the executable is written to standard output")
+		}
+		var err error
+		// the key is loaded first, so invalid keys are reported before the long compilation
+		signer, err = sign.LoadSigner(c.signKey)
+		if err != nil {
+			return err
+		}
+	}
+
 	destination := c.output
 	if destination == "" {
 		destination = "." // will replaced by absolute path below
 	}
 
-	if c.output == "-" {
+	if c.output == "-" && !c.DryRun {
 		// NB: Find a way to avoid creating another temp file
 		var err error
 		destination, err = touchTempFile()
@@ -52,17 +75,24 @@ func (c *BuildCommand) Action(stdout io.Writer) error {
 		}()
 	}
 
-	destination, err := filepath.Abs(destination)
-	if err != nil {
-		return merry.Wrap(err)
+	if destination != "-" {
+		var err error
+		destination, err = filepath.Abs(destination)
+		if err != nil {
+			return merry.Wrap(err)
+		}
 	}
 
-	err = c.compile("build", "-o", destination)
+	executable, err := c.compile(ctx, "build", "-o", destination)
 	if err != nil {
 		return err
 	}
 
-	if c.output == "-" {
+	if signer != nil {
+		return c.signOutputs(signer, executable)
+	}
+
+	if c.output == "-" && !c.DryRun {
 		var destFile *os.File
 		destFile, err = os.Open(destination)
 		if err != nil {
@@ -76,6 +106,20 @@ func (c *BuildCommand) Action(stdout io.Writer) error {
 
 }
 
+// signOutputs writes a detached signature next to each of the given executables
+func (c *BuildCommand) signOutputs(signer ssh.Signer, outputs ...string) error {
+	return run.Step("sign", func() error {
+		for _, output := range outputs {
+			sigPath, err := sign.File(signer, output)
+			if err != nil {
+				return err
+			}
+			slog.Info("signed executable", "signature", sigPath)
+		}
+		return nil
+	})
+}
+
 func touchTempFile() (string, error) {
 	tmpFile, err := os.CreateTemp("", "usqlgen")
 	if err != nil {
@@ -2,6 +2,7 @@ package shell
 
 import (
 	"bytes"
+	"context"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -31,7 +32,7 @@ func TestBuild(t *testing.T) {
 		}
 
 		var buf bytes.Buffer
-		err := cmd.Action(&buf)
+		err := cmd.Action(t.Context(), &buf)
 		require.NoError(t, err)
 		require.NotEmpty(t, buf)
 
@@ -49,7 +50,7 @@ func TestBuild(t *testing.T) {
 		currentWorkDir := fi.NoError(os.Getwd()).Require(t)
 		defer fi.NoErrorF(lang.Bind(os.Chdir, currentWorkDir), t)
 		require.NoError(t, os.Chdir(tmpDir))
-		err := cmd.Action(nil)
+		err := cmd.Action(t.Context(), nil)
 		require.NoError(t, err)
 
 		outputTmpFile := filepath.Join(tmpDir, "usql")
@@ -63,15 +64,15 @@ func TestBuild(t *testing.T) {
 			output:         "-",
 		}
 		testVersion := "1.2.3"
-		cmd.generator = func(input gen.Input) (gen.Result, error) {
-			res, err := minimalGoGenerator(input)
+		cmd.generator = func(ctx context.Context, input gen.Input) (gen.Result, error) {
+			res, err := minimalGoGenerator(ctx, input)
 			res.DownloadedUsqlVersion = testVersion
 			return res, err
 		}
 
 		var buf bytes.Buffer
 		cmd.NoTrimPath = true
-		err := cmd.Action(&buf)
+		err := cmd.Action(t.Context(), &buf)
 		require.NoError(t, err)
 		require.Contains(t, buf.String(), testVersion+"_usqlgen")
 	})
@@ -85,7 +86,7 @@ func TestBuild(t *testing.T) {
 		currentWorkDir := fi.NoError(os.Getwd()).Require(t)
 		defer fi.NoErrorF(lang.Bind(os.Chdir, currentWorkDir), t)
 		require.NoError(t, os.Chdir(tmpDir))
-		err := cmd.Action(nil)
+		err := cmd.Action(t.Context(), nil)
 		require.NoError(t, err)
 
 		outputTmpFile := filepath.Join(tmpDir, "usql")
@@ -112,8 +113,8 @@ func minimalCompileCommand() CompileCommand {
 	}
 }
 
-func minimalGoGenerator(input gen.Input) (result gen.Result, err error) {
-	err = run.Go(input.WorkingDir, "mod", "init", "usql")
+func minimalGoGenerator(ctx context.Context, input gen.Input) (result gen.Result, err error) {
+	err = run.Go(ctx, input.WorkingDir, "mod", "init", "usql")
 	if err != nil {
 		return
 	}
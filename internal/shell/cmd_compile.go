@@ -1,100 +1,367 @@
 package shell
 
 import (
+	"bytes"
+	"context"
+	"go/version"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/ansel1/merry/v2"
+	"github.com/samber/lo"
 	"github.com/sclgo/usqlgen/internal/gen"
 	"github.com/sclgo/usqlgen/internal/run"
 	"github.com/urfave/cli/v2"
 )
 
+// mainPackageDir is the name of the directory, where build and install generate code.
+// go build names the executable after it.
+const mainPackageDir = "usql"
+
 type CompileCommand struct {
 	CommandBase
-	generator func(gen.Input) (gen.Result, error)
+	generator func(context.Context, gen.Input) (gen.Result, error)
 	goBin     string
+	// buildEnv and buildFlags are added to the compilation command e.g. to reproduce the build of a binary
+	buildEnv   []string
+	buildFlags []string
+	// signKey is the --sign-key of build, if any. It is here, so --dry-run can plan the signing.
+	signKey string
 
 	// Options that control generation
-	Imports     cli.StringSlice
-	Replaces    cli.StringSlice
-	Gets        cli.StringSlice
-	USQLModule  string
-	USQLVersion string
-	DbOptions   cli.StringSlice
+	Imports         cli.StringSlice
+	Replaces        cli.StringSlice
+	Gets            cli.StringSlice
+	Likes           cli.StringSlice
+	Dialects        specList
+	VersionQueries  specList
+	Rewrites        specList
+	Classifications specList
+	Processors      cli.StringSlice
+	InitFiles       cli.StringSlice
+	InitSnippets    specList
+	Connectors      specList
+	Variables       specList
+	PrintVariables  specList
+	EnvDefaults     specList
+	Patches         cli.StringSlice
+	Excludes        cli.StringSlice
+	Toolchain       string
+	PGO             string
+	MainTemplate    string
+	USQLModule      string
+	USQLVersion     string
+	DbOptions       cli.StringSlice
 
 	// Options that control compilation only
 	Static     bool
 	NoTrimPath bool
+
+	// Race and Cover enable instrumented build variants with the race detector and coverage respectively
+	Race  bool
+	Cover bool
+
+	// SizeReport enables the breakdown of the size of the compiled executable
+	SizeReport bool
+
+	// NoDepsReport disables the report of dependency changes, made by the generated code
+	NoDepsReport bool
+
+	// Timeout limits the duration of generation and compilation, if positive
+	Timeout time.Duration
+
+	// DryRun prints the plan of generation and compilation instead of executing it
+	DryRun     bool
+	PlanFormat string
 }
 
-func (c *CompileCommand) compile(compileCmd string, compileArgs ...string) error {
+// compile generates usql in a temporary directory and compiles it with the given go command, unless compileCmd
+// is empty. It returns the path of the executable, produced by the go command, if it is signed or its size
+// is reported.
+func (c *CompileCommand) compile(ctx context.Context, compileCmd string, compileArgs ...string) (string, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	if c.DryRun {
+		return "", c.printPlan(ctx, temporaryDirPlaceholder, compileCmd, compileArgs...)
+	}
+
+	progress := c.startProgress()
+	if progress != nil {
+		defer progress.Stop()
+	}
+
 	tmpDir, err := os.MkdirTemp("", "usqlgen")
 	if err != nil {
-		return merry.Wrap(err)
+		return "", merry.Wrap(err)
 	}
 	defer func() {
 		_ = os.RemoveAll(tmpDir)
 	}()
-	workingDir := filepath.Join(tmpDir, "usql")
+	workingDir := filepath.Join(tmpDir, mainPackageDir)
 	err = os.Mkdir(workingDir, 0700)
 	if err != nil {
-		return merry.Wrap(err)
+		return "", merry.Wrap(err)
 	}
-	genResult, err := c.generate(workingDir)
+	genResult, err := c.generate(ctx, workingDir, compileCmd)
 	if err != nil {
-		return merry.Wrap(err)
+		return "", merry.Wrap(err)
 	}
 
 	if compileCmd == "" {
-		return run.GoBin(workingDir, nil, c.goBin, "mod", "tidy")
+		return "", run.GoBin(ctx, workingDir, nil, c.goBin, "mod", "tidy")
+	}
+
+	var trace *run.BuildTrace
+	if progress != nil && c.supportsBuildJSON(ctx, workingDir) {
+		trace = progress.BuildTrace()
+	}
+	goCmd := c.compileCommand(workingDir, genResult.DownloadedUsqlVersion, trace != nil, compileCmd, compileArgs...)
+	if trace != nil {
+		goCmd.Stdout = trace
+	}
+	err = run.Step(compileCmd, func() error {
+		err := goCmd.Run(ctx)
+		if err != nil && trace != nil {
+			// with -json, compiler errors are in the standard output
+			failureOutput := trace.FailureOutput()
+			err = run.WrapFailure(err, failureOutput, merry.AppendMessagef("compiler output:\n%s", failureOutput))
+		}
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	c.reportDependencies(ctx, goCmd, genResult)
+	if !c.SizeReport && c.signKey == "" {
+		// resolving the path runs go, so it is done only for the size report and signing
+		return "", nil
+	}
+	executable, err := executablePath(ctx, goCmd)
+	if err != nil {
+		return "", err
 	}
+	if c.SizeReport {
+		c.reportSize(ctx, goCmd, executable)
+	}
+	return executable, nil
+}
 
+// reportDependencies prints how the generated module changed the dependencies of usql, unless disabled.
+// Failures are only logged, since the report is informational.
+func (c *CompileCommand) reportDependencies(ctx context.Context, goCmd run.Command, genResult gen.Result) {
+	if c.NoDepsReport || c.Globals.Quiet || len(genResult.OriginalModules) == 0 {
+		return
+	}
+	var report gen.DependencyReport
+	err := run.Step("dependency report", func() error {
+		var reportErr error
+		report, reportErr = gen.Report(ctx, goCmd.Dir, genResult.OriginalModules, c.buildOptions(goCmd))
+		return reportErr
+	})
+	if err != nil {
+		slog.Warn("Failed to create dependency report", "error", err)
+		return
+	}
+	if c.Globals.LogFormat == logFormatJSON {
+		slog.Info("dependency report", "changes", report.Changes)
+		return
+	}
+	out := lo.CoalesceOrEmpty(c.Globals.Stderr, io.Writer(os.Stderr))
+	_, _ = io.WriteString(out, report.Text())
+}
+
+// compileCommand assembles the go command that compiles the generated code in workingDir.
+// If traced is true, the command produces -json -x output for BuildTrace.
+func (c *CompileCommand) compileCommand(workingDir string, usqlVersion string, traced bool, compileCmd string, compileArgs ...string) run.Command {
 	var addEnv []string
 	args := []string{compileCmd}
 	args = append(args, compileArgs...)
 	// -ldflags can be repeated so this doesn't interfere with PassthroughArgs
-	ldflags := `-X github.com/xo/usql/text.CommandVersion=` + makeVersion(genResult.DownloadedUsqlVersion)
+	ldflags := `-X github.com/xo/usql/text.CommandVersion=` + makeVersion(usqlVersion, c.variants()...)
 	if c.Static {
 		ldflags += ` -extldflags "-static"`
 		args = append(args, "-a")
-		addEnv = append(addEnv, "CGO_ENABLED=0")
+		if !c.Race {
+			addEnv = append(addEnv, "CGO_ENABLED=0")
+		}
 	}
 
+	if c.Race {
+		// the race detector requires cgo on most platforms
+		addEnv = append(addEnv, "CGO_ENABLED=1")
+	}
+	args = append(args, c.variantFlags()...)
+
 	args = append(args, "-ldflags", ldflags)
 
 	if !c.NoTrimPath {
 		args = append(args, "-trimpath")
 	}
 
+	if c.PGO != "" {
+		// the generator copies the profile to the main package
+		args = append(args, "-pgo=default.pgo")
+	}
+
 	// NB: This might interfere with PassthroughArgs
 	// Required to avoid go mod tidy when adding just imports
 	args = append(args, "-mod=mod")
 
+	if traced {
+		// -json -x output is parsed to count compiled packages
+		args = append(args, "-json", "-x")
+	}
+
+	addEnv = append(addEnv, c.buildEnv...)
+	args = append(args, c.buildFlags...)
 	args = append(args, c.Globals.PassthroughArgs...)
 	args = append(args, ".")
-	return run.GoBin(workingDir, addEnv, c.goBin, args...)
+	return run.Command{
+		Dir:    workingDir,
+		AddEnv: addEnv,
+		GoBin:  c.goBin,
+		Args:   args,
+	}
 }
 
-func makeVersion(downloadedVersion string) string {
-	// we use _ as separator so it doesn't interfere with the suggested go install logic in usql/main.go
-	return downloadedVersion + "_usqlgen"
+// supportsBuildJSON reports whether the go command supports go build -json, added in Go 1.24.
+// Older versions build without package counts in the progress display.
+func (c *CompileCommand) supportsBuildJSON(ctx context.Context, workingDir string) bool {
+	var goVersion bytes.Buffer
+	err := run.Command{
+		Dir:    workingDir,
+		AddEnv: c.buildEnv,
+		GoBin:  c.goBin,
+		Args:   []string{"env", "GOVERSION"},
+		Stdout: &goVersion,
+	}.Run(ctx)
+	if err != nil {
+		slog.Debug("Failed to get go version; building without progress of packages", "error", err)
+		return false
+	}
+	return buildJSONSupported(strings.TrimSpace(goVersion.String()))
 }
 
-func (c *CompileCommand) generate(workingDir string) (gen.Result, error) {
-	genInput := gen.Input{
-		Imports:     c.Imports.Value(),
-		Replaces:    c.Replaces.Value(),
-		Gets:        c.Gets.Value(),
-		WorkingDir:  workingDir,
-		USQLVersion: c.USQLVersion,
-		USQLModule:  c.USQLModule,
+// buildJSONSupported reports whether the given GOVERSION supports go build -json.
+// Development versions are not recognized, so they are assumed not to support it.
+func buildJSONSupported(goVersion string) bool {
+	return version.Compare(goVersion, minBuildJSONVersion) >= 0
+}
+
+// minBuildJSONVersion is the first go version that supports go build -json
+const minBuildJSONVersion = "go1.24"
+
+// withTimeout applies the configured timeout, if any, to the given context
+func (c *CompileCommand) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.Timeout > 0 {
+		return context.WithTimeoutCause(ctx, c.Timeout, merry.Errorf("usqlgen timed out after %s, as set by --timeout", c.Timeout))
 	}
-	err := applyOptionsFromNames(c.DbOptions.Value(), &genInput)
+	return context.WithCancel(ctx)
+}
+
+// startProgress starts the progress display, if enabled. Caller must stop the returned progress if not nil.
+func (c *CompileCommand) startProgress() *run.Progress {
+	progress := c.Globals.NewProgress()
+	if progress != nil {
+		progress.Start()
+	}
+	return progress
+}
+
+// variantFlags returns the build flags of the instrumented build variants
+func (c *CompileCommand) variantFlags() []string {
+	var flags []string
+	if c.Race {
+		flags = append(flags, "-race")
+	}
+	if c.Cover {
+		// without -coverpkg, only packages in the usql module would be instrumented
+		coverPkgs := append([]string{"./..."}, c.Imports.Value()...)
+		flags = append(flags, "-cover", "-coverpkg="+strings.Join(coverPkgs, ","))
+	}
+	return flags
+}
+
+// variants returns the names of the instrumented build variants, enabled by flags
+func (c *CompileCommand) variants() []string {
+	var variants []string
+	if c.Race {
+		variants = append(variants, "race")
+	}
+	if c.Cover {
+		variants = append(variants, "cover")
+	}
+	return variants
+}
+
+// specList is a repeatable flag value. Unlike cli.StringSlice, values are not split on commas,
+// because they may contain commas themselves.
+type specList []string
+
+func (l *specList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func (l *specList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, " ")
+}
+
+func makeVersion(downloadedVersion string, variants ...string) string {
+	// we use _ as separator so it doesn't interfere with the suggested go install logic in usql/main.go
+	return strings.Join(append([]string{downloadedVersion, "usqlgen"}, variants...), "_")
+}
+
+func (c *CompileCommand) generate(ctx context.Context, workingDir string, compileCmd string) (gen.Result, error) {
+	genInput, err := c.genInput(workingDir, compileCmd)
 	if err != nil {
 		return gen.Result{}, err
 	}
-	return c.generator(genInput)
+	return c.generator(ctx, genInput)
+}
+
+// genInput creates the generator input. compileCmd is the go command that will compile the generated code,
+// if any.
+func (c *CompileCommand) genInput(workingDir string, compileCmd string) (gen.Input, error) {
+	genInput := gen.Input{
+		Imports:         c.Imports.Value(),
+		Replaces:        c.Replaces.Value(),
+		Gets:            c.Gets.Value(),
+		Likes:           c.Likes.Value(),
+		Dialects:        c.Dialects,
+		VersionQueries:  c.VersionQueries,
+		Rewrites:        c.Rewrites,
+		Classifications: c.Classifications,
+		Processors:      c.Processors.Value(),
+		InitFiles:       c.InitFiles.Value(),
+		InitSnippets:    c.InitSnippets,
+		Connectors:      c.Connectors,
+		Variables:       c.Variables,
+		PrintVariables:  c.PrintVariables,
+		EnvDefaults:     c.EnvDefaults,
+		Patches:         c.Patches.Value(),
+		Excludes:        c.Excludes.Value(),
+		Toolchain:       c.Toolchain,
+		PGOProfile:      c.PGO,
+		MainTemplate:    c.MainTemplate,
+		WorkingDir:      workingDir,
+		USQLVersion:     c.USQLVersion,
+		USQLModule:      c.USQLModule,
+		// compileCommand uses -mod=mod, which makes go mod tidy redundant
+		NoTidy:             compileCmd != "",
+		NoDependencyReport: c.NoDepsReport || c.Globals.Quiet,
+	}
+	err := applyOptionsFromNames(c.DbOptions.Value(), &genInput)
+	return genInput, err
 }
 
 func (c *CompileCommand) MakeFlags() []cli.Flag {
@@ -116,6 +383,91 @@ func (c *CompileCommand) MakeFlags() []cli.Flag {
 			Usage:       "adds or updates the provided module using go get",
 			Destination: &c.Gets,
 		},
+		&cli.StringSliceFlag{
+			Name:        "like",
+			Usage:       "registers an imported driver with the configuration of a built-in usql driver e.g. pgx=postgres, can be repeated",
+			Destination: &c.Likes,
+		},
+		&cli.GenericFlag{
+			Name:  "dialect",
+			Usage: "configures SQL highlighting and splitting of an imported driver as driver:setting[,setting...]; settings are lexer=name, allow-dollar, allow-multiline-comments, allow-c-comments, allow-hash-comments, batch=prefix:end; can be repeated",
+			Value: &c.Dialects,
+		},
+		&cli.GenericFlag{
+			Name:  "version-query",
+			Usage: "configures the query that returns the server version for an imported driver as driver:query e.g. \"sqlite3:SELECT sqlite_version()\", can be repeated",
+			Value: &c.VersionQueries,
+		},
+		&cli.GenericFlag{
+			Name:  "rewrite",
+			Usage: "rewrites statements of an imported driver before execution as driver:/pattern/replacement/, where pattern is a Go regular expression and any delimiter can be used instead of /; applied in order, can be repeated",
+			Value: &c.Rewrites,
+		},
+		&cli.GenericFlag{
+			Name:  "classify",
+			Usage: "executes statements of an imported driver, matching a Go regular expression, as queries or execs as driver:query=pattern or driver:exec=pattern; the first match applies, can be repeated",
+			Value: &c.Classifications,
+		},
+		&cli.StringSliceFlag{
+			Name:        "processor",
+			Usage:       "preprocesses statements of an imported driver with a Go value, implementing Process(prefix, sql string) (string, bool, bool, error), as driver:package.Symbol, can be repeated",
+			Destination: &c.Processors,
+		},
+		&cli.StringSliceFlag{
+			Name:        "init-file",
+			Usage:       "adds a Go source file in package main to the generated main package e.g. with an init function that configures drivers, can be repeated",
+			Destination: &c.InitFiles,
+		},
+		&cli.GenericFlag{
+			Name:  "init",
+			Usage: "runs the given Go statements before new drivers are registered; packages from the standard library, --import and usql dependencies are imported automatically, can be repeated",
+			Value: &c.InitSnippets,
+		},
+		&cli.GenericFlag{
+			Name:  "connector",
+			Usage: "registers a driver for a library that only provides a connector constructor as name=driver,func=package.Func[,dsn=package.ParseFunc][,noerr]; Func takes the DSN or the result of ParseFunc, can be repeated",
+			Value: &c.Connectors,
+		},
+		&cli.GenericFlag{
+			Name:  "set",
+			Usage: "sets the default of a usql variable as NAME=VALUE, like \\set; usqlrc and the usql command-line override it, can be repeated",
+			Value: &c.Variables,
+		},
+		&cli.GenericFlag{
+			Name:  "pset",
+			Usage: "sets the default of a usql print option as NAME=VALUE, like \\pset; usqlrc and the usql command-line override it, can be repeated",
+			Value: &c.PrintVariables,
+		},
+		&cli.GenericFlag{
+			Name:  "setenv",
+			Usage: "sets the default of an environment variable of usql as NAME=VALUE, used if the variable is not set, can be repeated",
+			Value: &c.EnvDefaults,
+		},
+		&cli.StringSliceFlag{
+			Name:        "patch",
+			Usage:       "applies a unified diff, relative to the usql module root, to the downloaded usql code before generation, can be repeated",
+			Destination: &c.Patches,
+		},
+		&cli.StringSliceFlag{
+			Name:        "exclude",
+			Usage:       "adds an exclude directive for the given module@version to the generated module, can be repeated",
+			Destination: &c.Excludes,
+		},
+		&cli.StringFlag{
+			Name:        "toolchain",
+			Usage:       "sets the toolchain line of the generated module e.g. go1.23.4",
+			Destination: &c.Toolchain,
+		},
+		&cli.StringFlag{
+			Name:        "pgo",
+			Usage:       "CPU profile of usql for profile-guided optimization; see also 'usqlgen pgo merge'",
+			Destination: &c.PGO,
+		},
+		&cli.StringFlag{
+			Name:        "main-template",
+			Usage:       "text/template file that replaces the template of the generated main; see 'usqlgen list main-template'",
+			Destination: &c.MainTemplate,
+		},
 		&cli.StringFlag{
 			Name:        "usql-module",
 			Usage:       "module name of usql fork to use if needed",
@@ -139,18 +491,114 @@ func (c *CompileCommand) MakeFlags() []cli.Flag {
 			Usage:       `creates a static usql binary; implies env. var CGO_ENABLED=0`,
 			Destination: &c.Static,
 		},
+		&cli.BoolFlag{
+			Name:        "race",
+			Usage:       `builds usql with the race detector; implies env. var CGO_ENABLED=1, even with --static`,
+			Destination: &c.Race,
+		},
+		&cli.BoolFlag{
+			Name:        "cover",
+			Usage:       `builds usql with coverage instrumentation of usql and imported packages; run usql with env. var GOCOVERDIR to collect coverage`,
+			Destination: &c.Cover,
+		},
 		&cli.BoolFlag{
 			Name:        "no-trimpath",
 			Usage:       `don't include -trimpath in compilation commands`,
 			Destination: &c.NoTrimPath,
 		},
+		&cli.BoolFlag{
+			Name:        "no-deps-report",
+			Usage:       `don't report which dependencies of usql were added, upgraded or downgraded by the generated code`,
+			Destination: &c.NoDepsReport,
+		},
+		&cli.BoolFlag{
+			Name:        "size-report",
+			Usage:       `after build or install, breaks down the executable size by module and suggests no_xxx tags that remove the largest drivers`,
+			Destination: &c.SizeReport,
+		},
+		&cli.BoolFlag{
+			Name:        "dry-run",
+			Usage:       `prints every step and go command that would be executed, without executing them; only validates inputs and resolves the usql version`,
+			Destination: &c.DryRun,
+		},
+		&cli.StringFlag{
+			Name:        "plan-format",
+			Usage:       `format of the --dry-run output: text or json`,
+			Value:       planFormatText,
+			Destination: &c.PlanFormat,
+		},
+		&cli.DurationFlag{
+			Name:        "timeout",
+			Usage:       `stops generation and compilation after the given duration e.g. 10m; no timeout by default`,
+			Destination: &c.Timeout,
+		},
 	}, c.CommandBase.MakeFlags()...)
 }
 
 func MakeCompileCmd(globals *GlobalParams) CompileCommand {
 	return CompileCommand{
-		generator:   gen.Input.AllDownload,
+		generator:   generateAll,
 		goBin:       run.FindGo(),
 		CommandBase: Base(globals),
 	}
 }
+
+func generateAll(ctx context.Context, input gen.Input) (gen.Result, error) {
+	return input.AllDownload(ctx)
+}
+
+// reportSize prints the size breakdown of the executable, compiled by goCmd.
+// Failures are only logged, since the report is informational.
+func (c *CompileCommand) reportSize(ctx context.Context, goCmd run.Command, executable string) {
+	var report gen.SizeReport
+	err := run.Step("size report", func() error {
+		var err error
+		report, err = gen.BuildSizeReport(ctx, goCmd.Dir, executable, c.buildOptions(goCmd))
+		return err
+	})
+	if err != nil {
+		slog.Warn("Failed to create size report", "error", err)
+		return
+	}
+	if c.Globals.LogFormat == logFormatJSON {
+		slog.Info("size report", "report", report)
+		return
+	}
+	out := lo.CoalesceOrEmpty(c.Globals.Stderr, io.Writer(os.Stderr))
+	_, _ = io.WriteString(out, report.Text())
+}
+
+// buildOptions returns the environment and the flags of goCmd that select the compiled packages and files
+func (c *CompileCommand) buildOptions(goCmd run.Command) gen.BuildOptions {
+	flags := append(append(c.variantFlags(), c.buildFlags...), c.Globals.PassthroughArgs...)
+	return gen.BuildOptions{Env: goCmd.AddEnv, Flags: flags}
+}
+
+// executablePath returns the path of the executable, written by the go build or go install command
+func executablePath(ctx context.Context, goCmd run.Command) (string, error) {
+	if idx := slices.Index(goCmd.Args, "-o"); idx >= 0 && idx+1 < len(goCmd.Args) {
+		output := goCmd.Args[idx+1]
+		if stat, err := os.Stat(output); err != nil || !stat.IsDir() {
+			return output, nil
+		}
+		// go build names the executable after the directory of the main package, with the suffix of the target OS
+		var exeSuffix bytes.Buffer
+		err := run.Command{
+			Dir:    goCmd.Dir,
+			AddEnv: goCmd.AddEnv,
+			GoBin:  goCmd.GoBin,
+			Args:   []string{"env", "GOEXE"},
+			Stdout: &exeSuffix,
+		}.Run(ctx)
+		return filepath.Join(output, filepath.Base(goCmd.Dir)+strings.TrimSpace(exeSuffix.String())), err
+	}
+	var target bytes.Buffer
+	err := run.Command{
+		Dir:    goCmd.Dir,
+		AddEnv: goCmd.AddEnv,
+		GoBin:  goCmd.GoBin,
+		Args:   []string{"list", "-mod=mod", "-f", "{{.Target}}", "."},
+		Stdout: &target,
+	}.Run(ctx)
+	return strings.TrimSpace(target.String()), err
+}
@@ -1,10 +1,15 @@
 package shell
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/sclgo/usqlgen/internal/gen"
 	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
 )
 
 func TestCompile(t *testing.T) {
@@ -12,7 +17,7 @@ func TestCompile(t *testing.T) {
 	t.Run("create tmp dir", func(t *testing.T) {
 		cmd := CompileCommand{
 			CommandBase: Base(new(GlobalParams)),
-			generator: func(input gen.Input) (gen.Result, error) {
+			generator: func(_ context.Context, input gen.Input) (gen.Result, error) {
 				require.DirExists(t, input.WorkingDir)
 				return gen.Result{}, nil
 			},
@@ -20,8 +25,100 @@ func TestCompile(t *testing.T) {
 			Static: true,
 		}
 
-		err := cmd.compile("build")
+		executable, err := cmd.compile(t.Context(), "build")
 		require.NoError(t, err)
+		// the path is resolved only for the size report and signing
+		require.Empty(t, executable)
 	})
+	t.Run("compiler errors with progress", func(t *testing.T) {
+		cmd := minimalCompileCommand()
+		cmd.generator = func(ctx context.Context, input gen.Input) (gen.Result, error) {
+			res, err := minimalGoGenerator(ctx, input)
+			require.NoError(t, err)
+			brokenMain := []byte("package main\nfunc main() { x }\n")
+			return res, os.WriteFile(filepath.Join(input.WorkingDir, "main.go"), brokenMain, 0644)
+		}
+		_, err := cmd.compile(t.Context(), "build", "-o", filepath.Join(t.TempDir(), "usql"))
+		require.ErrorContains(t, err, "undefined: x")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		var workingDir string
+		cmd := minimalCompileCommand()
+		cmd.Timeout = 50 * time.Millisecond
+		cmd.generator = func(ctx context.Context, input gen.Input) (gen.Result, error) {
+			workingDir = input.WorkingDir
+			<-ctx.Done()
+			return gen.Result{}, context.Cause(ctx)
+		}
+		_, err := cmd.compile(t.Context(), "build")
+		require.ErrorContains(t, err, "--timeout")
+		require.NoDirExists(t, workingDir)
+	})
+}
+
+func TestCompileCommand_Variants(t *testing.T) {
+	t.Run("race with static", func(t *testing.T) {
+		cmd := minimalCompileCommand()
+		cmd.Static = true
+		cmd.Race = true
+		goCmd := cmd.compileCommand(t.TempDir(), "v0.19.14", false, "build")
+		require.Contains(t, goCmd.Args, "-race")
+		require.Equal(t, []string{"CGO_ENABLED=1"}, goCmd.AddEnv)
+		require.Contains(t, goCmd.Args, `-X github.com/xo/usql/text.CommandVersion=v0.19.14_usqlgen_race -extldflags "-static"`)
+	})
+
+	t.Run("cover", func(t *testing.T) {
+		cmd := minimalCompileCommand()
+		cmd.Cover = true
+		require.NoError(t, cmd.Imports.Set("github.com/MonetDB/MonetDB-Go/v2"))
+		goCmd := cmd.compileCommand(t.TempDir(), "v0.19.14", false, "build")
+		require.Contains(t, goCmd.Args, "-coverpkg=./...,github.com/MonetDB/MonetDB-Go/v2")
+		require.Contains(t, goCmd.Args, "-X github.com/xo/usql/text.CommandVersion=v0.19.14_usqlgen_cover")
+	})
+
+	t.Run("build options", func(t *testing.T) {
+		cmd := minimalCompileCommand()
+		cmd.Race = true
+		cmd.Cover = true
+		cmd.Globals.PassthroughArgs = []string{"-tags", "most"}
+		goCmd := cmd.compileCommand(t.TempDir(), "v0.19.14", false, "build")
+		options := cmd.buildOptions(goCmd)
+		require.Equal(t, []string{"-race", "-cover", "-coverpkg=./...", "-tags", "most"}, options.Flags)
+		require.Equal(t, goCmd.AddEnv, options.Env)
+	})
+}
+
+func TestCompileCommand_SupportsBuildJSON(t *testing.T) {
+	require.True(t, buildJSONSupported("go1.24.6"))
+	require.True(t, buildJSONSupported("go1.25"))
+	require.False(t, buildJSONSupported("go1.23.4"))
+	require.False(t, buildJSONSupported("devel go1.26-abcdef"))
+
+	// the test runs with go 1.24+, as required by go.mod
+	cmd := minimalCompileCommand()
+	require.True(t, cmd.supportsBuildJSON(t.Context(), t.TempDir()))
+	cmd.goBin = "echo"
+	require.False(t, cmd.supportsBuildJSON(t.Context(), t.TempDir()))
+}
+
+func TestCompileCommand_MakeFlags(t *testing.T) {
+	cmd := minimalCompileCommand()
+	app := &cli.App{
+		Flags:  cmd.MakeFlags(),
+		Action: func(*cli.Context) error { return nil },
+	}
+	err := app.Run([]string{"usqlgen", "--dialect", "monetdb:lexer=postgres,allow-dollar", "--dialect", "other:allow-c-comments",
+		"--init", "sql.Register(\"a\", nil)", "--connector", "name=acme,func=github.com/acme/db.New,noerr",
+		"--set", "PROMPT1=%n,%M%R%# ", "--pset", "format=csv", "--setenv", "PAGER=less"})
+	require.NoError(t, err)
+	require.Equal(t, specList{"monetdb:lexer=postgres,allow-dollar", "other:allow-c-comments"}, cmd.Dialects)
 
+	genInput, err := cmd.genInput(t.TempDir(), "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"sql.Register(\"a\", nil)"}, genInput.InitSnippets)
+	require.Equal(t, []string{"name=acme,func=github.com/acme/db.New,noerr"}, genInput.Connectors)
+	require.Equal(t, []string{"PROMPT1=%n,%M%R%# "}, genInput.Variables)
+	require.Equal(t, []string{"format=csv"}, genInput.PrintVariables)
+	require.Equal(t, []string{"PAGER=less"}, genInput.EnvDefaults)
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
 )
 
 func TestGenerate(t *testing.T) {
@@ -14,7 +15,7 @@ func TestGenerate(t *testing.T) {
 			CompileCommand: minimalCompileCommand(),
 			output:         tmpDir,
 		}
-		err := cmd.Action(nil)
+		err := cmd.Action(cli.NewContext(nil, nil, nil))
 		require.NoError(t, err)
 
 		require.FileExists(t, filepath.Join(tmpDir, "go.mod"))
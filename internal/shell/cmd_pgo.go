@@ -0,0 +1,65 @@
+package shell
+
+import (
+	"context"
+	"os"
+
+	"github.com/ansel1/merry/v2"
+	"github.com/murfffi/gorich/helperr"
+	"github.com/sclgo/usqlgen/internal/run"
+	"github.com/urfave/cli/v2"
+)
+
+// PGOMergeCommand merges CPU profiles, captured from usql e.g. with the pprofweb option, into a single profile
+// for --pgo
+type PGOMergeCommand struct {
+	CommandBase
+
+	output string
+}
+
+func (c *PGOMergeCommand) MakeFlags() []cli.Flag {
+	return append(c.CommandBase.MakeFlags(),
+		&cli.StringFlag{
+			Name:        "output",
+			Usage:       `path to file where the merged profile will be written`,
+			Aliases:     []string{"o"},
+			Destination: &c.output,
+			Value:       "merged.pprof",
+		})
+}
+
+func (c *PGOMergeCommand) Action(cliCtx *cli.Context) error {
+	return c.merge(cliCtx.Context, cliCtx.Args().Slice())
+}
+
+// merge merges the given profiles with go tool pprof
+func (c *PGOMergeCommand) merge(ctx context.Context, profiles []string) error {
+	if len(profiles) == 0 {
+		return merry.New("no profiles to merge; pass the profile files as arguments")
+	}
+	for _, profile := range profiles {
+		if _, err := os.Stat(profile); err != nil {
+			return merry.Prependf(err, "invalid profile %q", profile)
+		}
+	}
+
+	outFile, err := os.Create(c.output)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	defer helperr.CloseQuietly(outFile)
+
+	err = run.Step("merge profiles", func() error {
+		return run.Command{
+			GoBin:  run.FindGo(),
+			Args:   append([]string{"tool", "pprof", "-proto"}, profiles...),
+			Stdout: outFile,
+		}.Run(ctx)
+	})
+	if err != nil {
+		_ = os.Remove(c.output)
+		return err
+	}
+	return merry.Wrap(outFile.Close())
+}
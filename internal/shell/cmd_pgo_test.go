@@ -0,0 +1,68 @@
+package shell
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"testing"
+	"time"
+
+	"github.com/murfffi/gorich/fi"
+	"github.com/sclgo/usqlgen/internal/gen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPGOMergeCommand(t *testing.T) {
+	first, second := captureProfile(t), captureProfile(t)
+	cmd := PGOMergeCommand{
+		CommandBase: Base(&GlobalParams{}),
+		output:      filepath.Join(t.TempDir(), "merged.pprof"),
+	}
+
+	t.Run("merge", func(t *testing.T) {
+		require.NoError(t, cmd.merge(t.Context(), []string{first, second}))
+		require.FileExists(t, cmd.output)
+	})
+
+	t.Run("build with merged profile", func(t *testing.T) {
+		// PGO recompiles the standard library
+		fi.SkipLongTest(t)
+		compileCmd := minimalCompileCommand()
+		compileCmd.PGO = cmd.output
+		compileCmd.generator = func(ctx context.Context, input gen.Input) (gen.Result, error) {
+			res, err := minimalGoGenerator(ctx, input)
+			require.NoError(t, err)
+			profile, err := os.ReadFile(input.PGOProfile)
+			require.NoError(t, err)
+			return res, os.WriteFile(filepath.Join(input.WorkingDir, "default.pgo"), profile, 0644)
+		}
+		_, err := compileCmd.compile(t.Context(), "build", "-o", filepath.Join(t.TempDir(), "usql"))
+		require.NoError(t, err)
+	})
+
+	t.Run("missing profile", func(t *testing.T) {
+		err := cmd.merge(t.Context(), []string{first, "missing.pprof"})
+		require.ErrorContains(t, err, "missing.pprof")
+	})
+
+	t.Run("no profiles", func(t *testing.T) {
+		require.ErrorContains(t, cmd.merge(t.Context(), nil), "no profiles")
+	})
+}
+
+func captureProfile(t *testing.T) string {
+	profilePath := filepath.Join(t.TempDir(), "cpu.pprof")
+	profileFile, err := os.Create(profilePath)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, profileFile.Close())
+	}()
+	require.NoError(t, pprof.StartCPUProfile(profileFile))
+	deadline := time.Now().Add(50 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		_ = filepath.Join("a", "b")
+	}
+	pprof.StopCPUProfile()
+	return profilePath
+}
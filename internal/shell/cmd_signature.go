@@ -0,0 +1,56 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ansel1/merry/v2"
+	"github.com/samber/lo"
+	"github.com/sclgo/usqlgen/internal/sign"
+	"github.com/urfave/cli/v2"
+)
+
+// VerifySignatureCommand verifies detached signatures, written by build --sign-key
+type VerifySignatureCommand struct {
+	CommandBase
+
+	publicKey string
+}
+
+func (c *VerifySignatureCommand) MakeFlags() []cli.Flag {
+	return append(c.CommandBase.MakeFlags(),
+		&cli.StringFlag{
+			Name:        "public-key",
+			Usage:       `path to the public key matching the --sign-key of the build, in authorized_keys (e.g. .pub file) or PEM format`,
+			Required:    true,
+			Destination: &c.publicKey,
+		})
+}
+
+func (c *VerifySignatureCommand) Action(cliCtx *cli.Context) error {
+	return c.verify(cliCtx.Args().Slice())
+}
+
+// verify checks the signature of each file, found next to the file with suffix .sig
+func (c *VerifySignatureCommand) verify(files []string) error {
+	if len(files) == 0 {
+		return merry.New("no files to verify; pass the signed files as arguments")
+	}
+	publicKey, err := sign.LoadPublicKey(c.publicKey)
+	if err != nil {
+		return err
+	}
+	out := lo.CoalesceOrEmpty(c.Globals.Stdout, io.Writer(os.Stdout))
+	for _, file := range files {
+		err = sign.Verify(publicKey, file, file+sign.Extension)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "%s: valid signature\n", file)
+		if err != nil {
+			return merry.Wrap(err)
+		}
+	}
+	return nil
+}
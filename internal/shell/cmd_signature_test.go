@@ -0,0 +1,62 @@
+package shell
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/murfffi/gorich/fi"
+	"github.com/sclgo/usqlgen/internal/sign"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSignedBuild(t *testing.T) {
+	dir := t.TempDir()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(privateKey, "")
+	require.NoError(t, err)
+	privatePath := filepath.Join(dir, "key")
+	require.NoError(t, os.WriteFile(privatePath, pem.EncodeToMemory(block), 0600))
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	require.NoError(t, err)
+	publicPath := filepath.Join(dir, "key.pub")
+	require.NoError(t, os.WriteFile(publicPath, ssh.MarshalAuthorizedKey(sshPublicKey), 0600))
+
+	buildCmd := BuildCommand{
+		CompileCommand: minimalCompileCommand(),
+		output:         dir,
+	}
+	buildCmd.signKey = privatePath
+	require.NoError(t, buildCmd.Action(t.Context(), nil))
+	binary := filepath.Join(dir, "usql")
+	require.FileExists(t, binary+".sig")
+
+	var out bytes.Buffer
+	verifyCmd := VerifySignatureCommand{CommandBase: Base(&GlobalParams{Stdout: &out}), publicKey: publicPath}
+	require.NoError(t, verifyCmd.verify([]string{binary}))
+	require.Equal(t, binary+": valid signature\n", out.String())
+
+	t.Run("windows", func(t *testing.T) {
+		fi.SkipLongTest(t)
+		outDir := t.TempDir()
+		windowsCmd := BuildCommand{
+			CompileCommand: minimalCompileCommand(),
+			output:         outDir,
+		}
+		windowsCmd.signKey = privatePath
+		windowsCmd.buildEnv = []string{"GOOS=windows", "GOARCH=amd64"}
+		require.NoError(t, windowsCmd.Action(t.Context(), nil))
+		require.FileExists(t, filepath.Join(outDir, "usql.exe"+sign.Extension))
+	})
+
+	t.Run("stdout", func(t *testing.T) {
+		buildCmd.output = "-"
+		require.ErrorContains(t, buildCmd.Action(t.Context(), nil), "--sign-key")
+	})
+}
@@ -0,0 +1,243 @@
+package shell
+
+import (
+	"context"
+	"crypto/sha256"
+	"debug/buildinfo"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"slices"
+	"strings"
+
+	"github.com/ansel1/merry/v2"
+	"github.com/murfffi/gorich/helperr"
+	"github.com/murfffi/gorich/lang"
+	"github.com/samber/lo"
+	"github.com/urfave/cli/v2"
+)
+
+// commandVersionRE matches the usql version, set by compileCommand, in -ldflags
+var commandVersionRE = regexp.MustCompile(`CommandVersion=(\S+)`)
+
+// envSettingRE matches build info settings that are environment variables e.g. CGO_ENABLED or GOARCH
+var envSettingRE = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// VerifyBuildCommand rebuilds a usql binary with the configuration given by flags and the build settings
+// recorded in the binary, and checks that the result is identical
+type VerifyBuildCommand struct {
+	CompileCommand
+
+	binary string
+}
+
+func (c *VerifyBuildCommand) MakeFlags() []cli.Flag {
+	return append(c.CompileCommand.MakeFlags(),
+		&cli.StringFlag{
+			Name:        "binary",
+			Usage:       `path to the usql binary to verify`,
+			Required:    true,
+			Destination: &c.binary,
+		})
+}
+
+func (c *VerifyBuildCommand) Action(cliCtx *cli.Context) error {
+	return c.verify(cliCtx.Context, cliCtx.IsSet)
+}
+
+// verify rebuilds the binary and compares it with the original.
+// Settings recorded in the binary override the flags, unless isSet reports that the flag was given.
+func (c *VerifyBuildCommand) verify(ctx context.Context, isSet func(flag string) bool) error {
+	expected, err := buildinfo.ReadFile(c.binary)
+	if err != nil {
+		return merry.Prependf(err, "failed to read build info of %s", c.binary)
+	}
+	err = c.reproduce(expected, isSet)
+	if err != nil {
+		return err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "usqlgen-verify")
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	rebuilt := filepath.Join(tmpDir, "usql")
+	_, err = c.compile(ctx, "build", "-o", rebuilt)
+	if err != nil {
+		return err
+	}
+
+	expectedHash, err := fileHash(c.binary)
+	if err != nil {
+		return err
+	}
+	rebuiltHash, err := fileHash(rebuilt)
+	if err != nil {
+		return err
+	}
+	if expectedHash == rebuiltHash {
+		out := lo.CoalesceOrEmpty(c.Globals.Stdout, io.Writer(os.Stdout))
+		_, err = fmt.Fprintf(out, "%s matches the configuration: sha256 %s\n", c.binary, expectedHash)
+		return merry.Wrap(err)
+	}
+
+	actual, err := buildinfo.ReadFile(rebuilt)
+	if err != nil {
+		return merry.Prependf(err, "failed to read build info of the rebuilt binary")
+	}
+	differences := diffBuildInfo(expected, actual)
+	if len(differences) == 0 {
+		differences = []string{"build info is identical; the binaries may differ because of paths (without -trimpath), cgo or the C toolchain"}
+	}
+	return merry.Errorf("%s doesn't match the configuration: sha256 %s, rebuilt sha256 %s\n  %s",
+		c.binary, expectedHash, rebuiltHash, strings.Join(differences, "\n  "))
+}
+
+// reproduce configures the compilation with the build settings recorded in the binary.
+// It fails if a setting that affects the binary can't be recovered and wasn't given.
+func (c *VerifyBuildCommand) reproduce(info *buildinfo.BuildInfo, isSet func(flag string) bool) error {
+	settings := buildSettings(info)
+	c.NoTrimPath = settings["-trimpath"] != "true"
+	c.Race = settings["-race"] == "true"
+	c.Cover = settings["-cover"] == "true"
+
+	// -ldflags are not recorded with -trimpath, which usqlgen uses by default
+	ldflags, hasLdflags := settings["-ldflags"]
+	usqlVersion := ""
+	if match := commandVersionRE.FindStringSubmatch(ldflags); match != nil {
+		usqlVersion, _, _ = strings.Cut(match[1], "_usqlgen")
+	} else {
+		usqlVersion = moduleVersion(info, lang.IfEmpty(c.USQLModule, "github.com/xo/usql"))
+	}
+	if !isSet("usql-version") {
+		if usqlVersion == "" {
+			return merry.Errorf("can't recover the usql version of %s from its build info, because it was built with -trimpath; "+
+				"pass --usql-version", c.binary)
+		}
+		c.USQLVersion = usqlVersion
+	}
+	if !isSet("static") {
+		switch {
+		case hasLdflags:
+			c.Static = strings.Contains(ldflags, `-extldflags "-static"`)
+		case settings["CGO_ENABLED"] != "0":
+			// without cgo, --static doesn't change the binary
+			return merry.Errorf("can't recover if %s was built with --static from its build info, because it was built "+
+				"with -trimpath and cgo; pass --static or --static=false", c.binary)
+		}
+	}
+
+	c.buildEnv, c.buildFlags = nil, nil
+	if tags := settings["-tags"]; tags != "" {
+		c.buildFlags = append(c.buildFlags, "-tags="+tags)
+	}
+	for _, setting := range info.Settings {
+		if envSettingRE.MatchString(setting.Key) {
+			c.buildEnv = append(c.buildEnv, setting.Key+"="+setting.Value)
+		}
+	}
+	// the go command downloads the toolchain, if it is not the local one
+	if toolchain := strings.Fields(info.GoVersion); len(toolchain) > 0 {
+		c.buildEnv = append(c.buildEnv, "GOTOOLCHAIN="+toolchain[0])
+	}
+	return nil
+}
+
+// moduleVersion returns the version of the module in the binary, either as the main module or as a dependency.
+// It returns an empty string if the version is unknown.
+func moduleVersion(info *buildinfo.BuildInfo, path string) string {
+	if info.Main.Path == path && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == path {
+			return dep.Version
+		}
+	}
+	return ""
+}
+
+func buildSettings(info *buildinfo.BuildInfo) map[string]string {
+	settings := make(map[string]string, len(info.Settings))
+	for _, setting := range info.Settings {
+		settings[setting.Key] = setting.Value
+	}
+	return settings
+}
+
+// diffBuildInfo describes the differences between the build info of two binaries, grouped as toolchain,
+// deps and flags
+func diffBuildInfo(expected *buildinfo.BuildInfo, actual *buildinfo.BuildInfo) []string {
+	var differences []string
+	if expected.GoVersion != actual.GoVersion {
+		differences = append(differences, fmt.Sprintf("toolchain: %s, rebuilt with %s", expected.GoVersion, actual.GoVersion))
+	}
+
+	expectedDeps, actualDeps := formatDeps(expected.Deps), formatDeps(actual.Deps)
+	for _, path := range sortedUnion(expectedDeps, actualDeps) {
+		if expectedDeps[path] != actualDeps[path] {
+			differences = append(differences, fmt.Sprintf("deps: %s %s, rebuilt with %s",
+				path, lang.IfEmpty(expectedDeps[path], "(none)"), lang.IfEmpty(actualDeps[path], "(none)")))
+		}
+	}
+
+	expectedSettings, actualSettings := comparableSettings(expected), comparableSettings(actual)
+	for _, key := range sortedUnion(expectedSettings, actualSettings) {
+		if expectedSettings[key] != actualSettings[key] {
+			differences = append(differences, fmt.Sprintf("flags: %s=%s, rebuilt with %s=%s",
+				key, expectedSettings[key], key, actualSettings[key]))
+		}
+	}
+	return differences
+}
+
+func formatDeps(deps []*debug.Module) map[string]string {
+	formatted := make(map[string]string, len(deps))
+	for _, dep := range deps {
+		version := dep.Version + " " + dep.Sum
+		if dep.Replace != nil {
+			version += " => " + dep.Replace.Path + " " + dep.Replace.Version + " " + dep.Replace.Sum
+		}
+		formatted[dep.Path] = strings.TrimSpace(version)
+	}
+	return formatted
+}
+
+// comparableSettings returns the build settings without VCS information, which is not available
+// for generated code, and with paths that differ between builds trimmed
+func comparableSettings(info *buildinfo.BuildInfo) map[string]string {
+	settings := buildSettings(info)
+	for key := range settings {
+		if strings.HasPrefix(key, "vcs.") {
+			delete(settings, key)
+		}
+	}
+	if pgo, ok := settings["-pgo"]; ok {
+		settings["-pgo"] = filepath.Base(pgo)
+	}
+	return settings
+}
+
+func sortedUnion(a map[string]string, b map[string]string) []string {
+	keys := lo.Union(lo.Keys(a), lo.Keys(b))
+	slices.Sort(keys)
+	return keys
+}
+
+func fileHash(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", merry.Wrap(err)
+	}
+	defer helperr.CloseQuietly(file)
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	return hex.EncodeToString(hash.Sum(nil)), merry.Wrap(err)
+}
@@ -0,0 +1,90 @@
+package shell
+
+import (
+	"bytes"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyBuildCommand(t *testing.T) {
+	binary := filepath.Join(t.TempDir(), "usql")
+	buildCmd := minimalCompileCommand()
+	buildCmd.Globals.PassthroughArgs = []string{"-tags", "most"}
+	_, err := buildCmd.compile(t.Context(), "build", "-o", binary)
+	require.NoError(t, err)
+
+	t.Run("match", func(t *testing.T) {
+		var out bytes.Buffer
+		cmd := VerifyBuildCommand{CompileCommand: minimalCompileCommand(), binary: binary}
+		cmd.Globals.Stdout = &out
+		require.NoError(t, cmd.verify(t.Context(), explicitFlags("usql-version", "static")))
+		require.Contains(t, out.String(), binary+" matches the configuration")
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		cmd := VerifyBuildCommand{CompileCommand: minimalCompileCommand(), binary: binary}
+		cmd.Globals.PassthroughArgs = []string{"-tags", "no_base"}
+		err := cmd.verify(t.Context(), explicitFlags("usql-version", "static"))
+		require.ErrorContains(t, err, "doesn't match the configuration")
+		require.ErrorContains(t, err, "flags: -tags=most, rebuilt with -tags=no_base")
+	})
+}
+
+func TestVerifyBuildCommand_Reproduce(t *testing.T) {
+	info := &debug.BuildInfo{
+		GoVersion: "go1.23.4",
+		Main:      debug.Module{Path: "github.com/xo/usql", Version: "(devel)"},
+		Settings: []debug.BuildSetting{
+			{Key: "-cover", Value: "true"},
+			{Key: "-trimpath", Value: "true"},
+			{Key: "CGO_ENABLED", Value: "1"},
+		},
+	}
+	cmd := VerifyBuildCommand{CompileCommand: minimalCompileCommand(), binary: "usql"}
+
+	err := cmd.reproduce(info, explicitFlags("static"))
+	require.ErrorContains(t, err, "can't recover the usql version of usql")
+	require.ErrorContains(t, err, "pass --usql-version")
+
+	err = cmd.reproduce(info, explicitFlags("usql-version"))
+	require.ErrorContains(t, err, "pass --static or --static=false")
+
+	info.Deps = []*debug.Module{{Path: "github.com/xo/usql", Version: "v0.19.14"}}
+	require.NoError(t, cmd.reproduce(info, explicitFlags("static")))
+	require.Equal(t, "v0.19.14", cmd.USQLVersion)
+	require.True(t, cmd.Cover)
+	require.Contains(t, cmd.buildEnv, "CGO_ENABLED=1")
+}
+
+// explicitFlags returns an IsSet function that reports the given flags as set
+func explicitFlags(flags ...string) func(string) bool {
+	return func(flag string) bool {
+		return slices.Contains(flags, flag)
+	}
+}
+
+func TestDiffBuildInfo(t *testing.T) {
+	expected := &debug.BuildInfo{
+		GoVersion: "go1.23.4",
+		Deps:      []*debug.Module{{Path: "example.com/a", Version: "v1.0.0", Sum: "h1:a"}},
+		Settings:  []debug.BuildSetting{{Key: "-tags", Value: "most"}, {Key: "vcs.revision", Value: "abc"}},
+	}
+	actual := &debug.BuildInfo{
+		GoVersion: "go1.24.0",
+		Deps: []*debug.Module{
+			{Path: "example.com/a", Version: "v1.0.0", Sum: "h1:a", Replace: &debug.Module{Path: "example.com/b", Version: "v1.1.0"}},
+			{Path: "example.com/c", Version: "v0.1.0"},
+		},
+		Settings: []debug.BuildSetting{{Key: "-tags", Value: "most"}, {Key: "CGO_ENABLED", Value: "0"}},
+	}
+	require.Equal(t, []string{
+		"toolchain: go1.23.4, rebuilt with go1.24.0",
+		"deps: example.com/a v1.0.0 h1:a, rebuilt with v1.0.0 h1:a => example.com/b v1.1.0",
+		"deps: example.com/c (none), rebuilt with v0.1.0",
+		"flags: CGO_ENABLED=, rebuilt with CGO_ENABLED=0",
+	}, diffBuildInfo(expected, actual))
+}
@@ -13,8 +13,9 @@ type InstallCommand struct {
 	CompileCommand
 }
 
-func (c *InstallCommand) Action(*cli.Context) error {
-	return c.compile("install")
+func (c *InstallCommand) Action(cliCtx *cli.Context) error {
+	_, err := c.compile(cliCtx.Context, "install")
+	return err
 }
 
 type GenerateCommand struct {
@@ -34,22 +35,41 @@ func (c *GenerateCommand) MakeFlags() []cli.Flag {
 		})
 }
 
-func (c *GenerateCommand) Action(*cli.Context) error {
+func (c *GenerateCommand) Action(cliCtx *cli.Context) error {
+	ctx, cancel := c.withTimeout(cliCtx.Context)
+	defer cancel()
+
+	if c.DryRun {
+		return c.printPlan(ctx, c.output, "")
+	}
+
 	err := os.MkdirAll(c.output, 0700)
 	if err != nil {
 		return merry.Wrap(err)
 	}
-	_, err = c.generate(c.output)
-	return err
+	progress := c.startProgress()
+	if progress != nil {
+		defer progress.Stop()
+	}
+	genResult, err := c.generate(ctx, c.output, "")
+	if err != nil {
+		return err
+	}
+	// the report lists the drivers that go build of the generated code would include
+	c.reportDependencies(ctx, c.compileCommand(c.output, genResult.DownloadedUsqlVersion, false, "build"), genResult)
+	return nil
 }
 
 type Commands struct {
 	CommandBase
 
-	Globals     *GlobalParams
-	BuildCmd    *BuildCommand
-	InstallCmd  *InstallCommand
-	GenerateCmd *GenerateCommand
+	Globals      *GlobalParams
+	BuildCmd     *BuildCommand
+	InstallCmd   *InstallCommand
+	GenerateCmd  *GenerateCommand
+	PGOMergeCmd  *PGOMergeCommand
+	VerifyCmd    *VerifyBuildCommand
+	VerifySigCmd *VerifySignatureCommand
 }
 
 func Base(globals *GlobalParams) CommandBase {
@@ -64,6 +84,7 @@ func NewCommands(passthroughArgs []string) *Commands {
 	}
 	return &Commands{
 		CommandBase: Base(globals),
+		Globals:     globals,
 		BuildCmd: &BuildCommand{
 			CompileCommand: MakeCompileCmd(globals),
 		},
@@ -73,5 +94,14 @@ func NewCommands(passthroughArgs []string) *Commands {
 		GenerateCmd: &GenerateCommand{
 			CompileCommand: MakeCompileCmd(globals),
 		},
+		VerifyCmd: &VerifyBuildCommand{
+			CompileCommand: MakeCompileCmd(globals),
+		},
+		VerifySigCmd: &VerifySignatureCommand{
+			CommandBase: Base(globals),
+		},
+		PGOMergeCmd: &PGOMergeCommand{
+			CommandBase: Base(globals),
+		},
 	}
 }
@@ -0,0 +1,142 @@
+package shell
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ansel1/merry/v2"
+	"github.com/murfffi/gorich/lang"
+	"github.com/samber/lo"
+	"github.com/sclgo/usqlgen/internal/gen"
+)
+
+const (
+	planFormatText = "text"
+	planFormatJSON = "json"
+
+	// temporaryDirPlaceholder stands for the temporary directory build and install generate code into
+	temporaryDirPlaceholder = "<temporary directory>"
+)
+
+// dryRunPlan is the output of --dry-run
+type dryRunPlan struct {
+	gen.Plan
+	WorkingDir string              `json:"workingDir"`
+	Compile    *gen.PlannedCommand `json:"compile,omitempty"`
+	// FinalSteps are the reports and the signing, done after generation and compilation, in order
+	FinalSteps []string `json:"finalSteps,omitempty"`
+}
+
+// printPlan validates the inputs and prints what generation and compilation would do in workingDir.
+// If compileCmd is empty, no compilation is planned.
+func (c *CompileCommand) printPlan(ctx context.Context, workingDir string, compileCmd string, compileArgs ...string) error {
+	format := lang.IfEmpty(c.PlanFormat, planFormatText)
+	if format != planFormatText && format != planFormatJSON {
+		return merry.Errorf("unknown plan format %q; use %s or %s", format, planFormatText, planFormatJSON)
+	}
+	genInput, err := c.genInput(workingDir, compileCmd)
+	if err != nil {
+		return err
+	}
+	genPlan, err := genInput.Plan(ctx)
+	if err != nil {
+		return err
+	}
+	plan := dryRunPlan{
+		Plan:       genPlan,
+		WorkingDir: workingDir,
+	}
+	if compileCmd != "" {
+		goCmd := c.compileCommand(workingDir, genPlan.ResolvedVersion, false, compileCmd, compileArgs...)
+		plan.Compile = &gen.PlannedCommand{
+			Step: compileCmd,
+			Env:  goCmd.AddEnv,
+			Args: goCmd.Args,
+		}
+	}
+	plan.FinalSteps = c.finalSteps(compileCmd)
+
+	out := lo.CoalesceOrEmpty(c.Globals.Stdout, io.Writer(os.Stdout))
+	if format == planFormatJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return merry.Wrap(encoder.Encode(plan))
+	}
+	_, err = io.WriteString(out, plan.text())
+	return merry.Wrap(err)
+}
+
+// finalSteps returns what compile does after the generation and compilation with compileCmd, if any
+func (c *CompileCommand) finalSteps(compileCmd string) []string {
+	var steps []string
+	if !c.NoDepsReport && !c.Globals.Quiet {
+		steps = append(steps, "dependency report")
+	}
+	if compileCmd != "" && c.SizeReport {
+		steps = append(steps, "size report")
+	}
+	if compileCmd != "" && c.signKey != "" {
+		steps = append(steps, fmt.Sprintf("sign the executable with %s into a .sig file next to it", c.signKey))
+	}
+	return steps
+}
+
+func (p dryRunPlan) text() string {
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "usql module: %s (resolved version %s)\n", p.USQLModule, p.ResolvedVersion)
+	_, _ = fmt.Fprintf(&sb, "working directory: %s\n", p.WorkingDir)
+	sb.WriteString("generated files:\n")
+	for _, file := range p.GeneratedFiles {
+		_, _ = fmt.Fprintf(&sb, "  %s\n", file)
+	}
+	if len(p.SourcePatchedFiles) > 0 {
+		sb.WriteString("files changed by --patch:\n")
+		for _, file := range p.SourcePatchedFiles {
+			_, _ = fmt.Fprintf(&sb, "  %s\n", file)
+		}
+	}
+	if len(p.PatchedFiles) > 0 {
+		sb.WriteString("patched files:\n")
+		for _, patch := range p.PatchedFiles {
+			_, _ = fmt.Fprintf(&sb, "  %s: %q -> %q\n", patch.File, patch.Before, patch.After)
+		}
+	}
+	if len(p.InitSnippets) > 0 {
+		sb.WriteString("init snippets:\n")
+		for _, snippet := range p.InitSnippets {
+			_, _ = fmt.Fprintf(&sb, "  %s\n", snippet)
+		}
+	}
+	if len(p.Connectors) > 0 {
+		sb.WriteString("drivers registered with connectors:\n")
+		for _, connector := range p.Connectors {
+			_, _ = fmt.Fprintf(&sb, "  %s\n", connector)
+		}
+	}
+	sb.WriteString("go.mod updates and compilation:\n")
+	writeCommand(&sb, p.GoGet)
+	// edits are applied between go get and tidy
+	for _, edit := range p.GoModEdits {
+		_, _ = fmt.Fprintf(&sb, "  [edit go.mod] %s\n", edit)
+	}
+	writeCommand(&sb, p.Tidy)
+	writeCommand(&sb, p.Compile)
+	if len(p.FinalSteps) > 0 {
+		sb.WriteString("then:\n")
+		for _, step := range p.FinalSteps {
+			_, _ = fmt.Fprintf(&sb, "  %s\n", step)
+		}
+	}
+	return sb.String()
+}
+
+// writeCommand writes the planned command, if any, as a line of the text plan
+func writeCommand(sb *strings.Builder, cmd *gen.PlannedCommand) {
+	if cmd != nil {
+		_, _ = fmt.Fprintf(sb, "  [%s] %s\n", cmd.Step, cmd)
+	}
+}
@@ -0,0 +1,71 @@
+package shell
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/murfffi/gorich/fi"
+	"github.com/sclgo/usqlgen/internal/gen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRunPlan_Text(t *testing.T) {
+	plan := dryRunPlan{
+		Plan: gen.Plan{
+			USQLModule:      "github.com/xo/usql@latest",
+			ResolvedVersion: "v0.19.14",
+			GeneratedFiles:  []string{"gen/dbmgr.go"},
+			GoModEdits:      []string{"replace a => b v1"},
+			Tidy:            &gen.PlannedCommand{Step: "tidy", Args: []string{"mod", "tidy"}},
+		},
+		WorkingDir: temporaryDirPlaceholder,
+		Compile: &gen.PlannedCommand{
+			Step: "build",
+			Env:  []string{"CGO_ENABLED=0"},
+			Args: []string{"build", "."},
+		},
+		FinalSteps: []string{"dependency report", "size report"},
+	}
+	text := plan.text()
+	require.Contains(t, text, "github.com/xo/usql@latest (resolved version v0.19.14)")
+	require.NotContains(t, text, "patched files:")
+	require.Contains(t, text, "[build] CGO_ENABLED=0 go build .\nthen:\n  dependency report\n  size report\n")
+	require.Contains(t, text, "[edit go.mod] replace a => b v1\n  [tidy] go mod tidy\n")
+	require.Contains(t, text, "[build] CGO_ENABLED=0 go build .\n")
+}
+
+func TestCompileCommand_PrintPlan(t *testing.T) {
+	t.Run("invalid input", func(t *testing.T) {
+		cmd := minimalCompileCommand()
+		require.NoError(t, cmd.Replaces.Set("foo"))
+		err := cmd.printPlan(t.Context(), temporaryDirPlaceholder, "build")
+		require.ErrorContains(t, err, "--replace")
+	})
+
+	t.Run("final steps", func(t *testing.T) {
+		cmd := minimalCompileCommand()
+		cmd.SizeReport = true
+		cmd.signKey = "id_ed25519"
+		require.Equal(t, []string{"dependency report", "size report", "sign the executable with id_ed25519 into a .sig file next to it"},
+			cmd.finalSteps("build"))
+		cmd.NoDepsReport = true
+		require.Empty(t, cmd.finalSteps(""))
+	})
+
+	t.Run("replace without tidy", func(t *testing.T) {
+		fi.SkipLongTest(t)
+		var out bytes.Buffer
+		cmd := minimalCompileCommand()
+		cmd.Globals.Stdout = &out
+		cmd.USQLVersion = "v0.19.14"
+		require.NoError(t, cmd.Replaces.Set("github.com/microsoft/go-mssqldb=github.com/dlapko/go-mssqldb@v1.0.0"))
+		require.NoError(t, cmd.printPlan(t.Context(), temporaryDirPlaceholder, "build", "."))
+
+		text := out.String()
+		edit := "  [edit go.mod] replace github.com/microsoft/go-mssqldb => github.com/dlapko/go-mssqldb v1.0.0\n"
+		require.Equal(t, 1, strings.Count(text, edit), text)
+		require.Contains(t, text, "go.mod updates and compilation:\n"+edit+"  [build] ")
+		require.NotContains(t, text, "[tidy]")
+	})
+}
@@ -0,0 +1,39 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/samber/lo"
+
+	"github.com/sclgo/usqlgen/internal/run"
+)
+
+// reportError reports an error returned by a command. Errors are logged in JSON log format,
+// otherwise, printed as is, because text logs would escape the multi-line go tool output.
+func (g *GlobalParams) reportError(err error) {
+	msg := formatError(err, g.Verbose)
+	if g.LogFormat == logFormatJSON {
+		slog.Error(msg)
+		return
+	}
+	_, _ = fmt.Fprintln(lo.CoalesceOrEmpty(g.Stderr, io.Writer(os.Stderr)), "Error:", msg)
+}
+
+// formatError formats errors returned by commands for end users.
+// Stack traces are only included in verbose mode.
+func formatError(err error, verbose bool) string {
+	format := "%v"
+	if verbose {
+		format = "%+v"
+	}
+	msg := fmt.Sprintf(format, err)
+	var goErr *run.GoError
+	if errors.As(err, &goErr) {
+		msg += fmt.Sprintf("\n\nProbable cause: %s\nSuggestion: %s", goErr.Explanation, goErr.Suggestion)
+	}
+	return msg
+}
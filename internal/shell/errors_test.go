@@ -0,0 +1,26 @@
+package shell
+
+import (
+	"testing"
+
+	"github.com/ansel1/merry/v2"
+	"github.com/sclgo/usqlgen/internal/run"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatError(t *testing.T) {
+	output := "go: sql: Register called twice for driver postgres"
+	err := run.WrapFailure(merry.New("exit status 1"), output)
+
+	t.Run("regular", func(t *testing.T) {
+		msg := formatError(err, false)
+		require.Contains(t, msg, "exit status 1")
+		require.Contains(t, msg, "no_postgres")
+		require.NotContains(t, msg, "errors_test.go")
+	})
+
+	t.Run("verbose", func(t *testing.T) {
+		msg := formatError(err, true)
+		require.Contains(t, msg, "errors_test.go")
+	})
+}
@@ -1,20 +1,32 @@
 package shell
 
 import (
+	"context"
 	"io"
-	"log"
+	"log/slog"
 	"os"
+	"os/signal"
 	"slices"
+	"strings"
+	"syscall"
 
+	"github.com/sclgo/usqlgen/internal/gen"
 	"github.com/urfave/cli/v2"
 )
 
 func RunArgs(args []string, writer, errWriter io.Writer) {
 	regularArgs, passthroughArgs := splitArgs(args)
-	app := makeApp(passthroughArgs, writer, errWriter)
-	if err := app.Run(regularArgs); err != nil {
+	commands := NewCommands(passthroughArgs)
+	app := makeApp(commands, writer, errWriter)
+	// On interrupt, the context is canceled so go commands are stopped and temporary files are removed
+	// before exiting. A second interrupt stops usqlgen immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+	if err := app.RunContext(ctx, regularArgs); err != nil {
 		// logs merry errors better than panic
-		log.Fatalf("%+v", err)
+		commands.Globals.reportError(err)
+		os.Exit(1)
 	}
 }
 
@@ -34,9 +46,19 @@ func Run() {
 	RunArgs(os.Args, nil, nil)
 }
 
-func makeApp(passthroughArgs []string, writer, errWriter io.Writer) *cli.App {
-	commands := NewCommands(passthroughArgs)
+func makeApp(commands *Commands, writer, errWriter io.Writer) *cli.App {
+	commands.Globals.Stdout = writer
+	commands.Globals.Stderr = errWriter
+	setupLogging := func(*cli.Context) error {
+		logger, err := commands.Globals.NewLogger()
+		if err != nil {
+			return err
+		}
+		slog.SetDefault(logger)
+		return nil
+	}
 	app := &cli.App{
+		Before:      setupLogging,
 		Description: "Distribution generator for xo/usql. Learn more at https://github.com/sclgo/usqlgen",
 		Flags:       commands.MakeFlags(),
 		Args:        false,
@@ -44,12 +66,13 @@ func makeApp(passthroughArgs []string, writer, errWriter io.Writer) *cli.App {
 		ErrWriter:   errWriter,
 		Commands: []*cli.Command{
 			{
-				Name:  "build",
-				Usage: "builds a usql binary distribution in the given directory",
-				Args:  false,
-				Flags: commands.BuildCmd.MakeFlags(),
-				Action: func(context *cli.Context) error {
-					return commands.BuildCmd.Action(writer)
+				Name:   "build",
+				Usage:  "builds a usql binary distribution in the given directory",
+				Args:   false,
+				Flags:  commands.BuildCmd.MakeFlags(),
+				Before: setupLogging,
+				Action: func(cliCtx *cli.Context) error {
+					return commands.BuildCmd.Action(cliCtx.Context, writer)
 				},
 			},
 			{
@@ -57,6 +80,7 @@ func makeApp(passthroughArgs []string, writer, errWriter io.Writer) *cli.App {
 				Usage:  "installs a usql binary distribution using 'go install'",
 				Args:   false,
 				Flags:  commands.InstallCmd.MakeFlags(),
+				Before: setupLogging,
 				Action: commands.InstallCmd.Action,
 			},
 			{
@@ -64,8 +88,39 @@ func makeApp(passthroughArgs []string, writer, errWriter io.Writer) *cli.App {
 				Usage:  "generates the code for the usql binary distribution without compiling it",
 				Args:   false,
 				Flags:  commands.GenerateCmd.MakeFlags(),
+				Before: setupLogging,
 				Action: commands.GenerateCmd.Action,
 			},
+			{
+				Name:   "verify-build",
+				Usage:  "rebuilds a usql binary with the given configuration and the build settings recorded in the binary, and checks that the result is identical",
+				Args:   false,
+				Flags:  commands.VerifyCmd.MakeFlags(),
+				Before: setupLogging,
+				Action: commands.VerifyCmd.Action,
+			},
+			{
+				Name:      "verify-signature",
+				Usage:     "verifies the detached signatures of usql binaries, created by build --sign-key",
+				ArgsUsage: "binary...",
+				Flags:     commands.VerifySigCmd.MakeFlags(),
+				Before:    setupLogging,
+				Action:    commands.VerifySigCmd.Action,
+			},
+			{
+				Name:  "pgo",
+				Usage: "subcommands help with profile-guided optimization of usql builds",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "merge",
+						Usage:     "merges CPU profiles, captured from usql, into a single profile for --pgo",
+						ArgsUsage: "profile...",
+						Flags:     commands.PGOMergeCmd.MakeFlags(),
+						Before:    setupLogging,
+						Action:    commands.PGOMergeCmd.Action,
+					},
+				},
+			},
 			{
 				Name:  "list",
 				Usage: "subcommands list various options and attributes",
@@ -76,6 +131,12 @@ func makeApp(passthroughArgs []string, writer, errWriter io.Writer) *cli.App {
 						Args:   false,
 						Action: listOptions,
 					},
+					{
+						Name:   "main-template",
+						Usage:  "displays the default template of the generated main, a starting point for --main-template",
+						Args:   false,
+						Action: listMainTemplate,
+					},
 				},
 			},
 		},
@@ -83,3 +144,8 @@ func makeApp(passthroughArgs []string, writer, errWriter io.Writer) *cli.App {
 	app.Usage = app.Description
 	return app
 }
+
+func listMainTemplate(c *cli.Context) error {
+	_, err := io.WriteString(c.App.Writer, strings.TrimPrefix(gen.DefaultMainTemplate(), "\n"))
+	return err
+}
@@ -14,3 +14,10 @@ func TestRunArgs(t *testing.T) {
 	require.Contains(t, buf.String(), "generate")
 	require.Contains(t, buf.String(), "import")
 }
+
+func TestRunArgs_ListMainTemplate(t *testing.T) {
+	var buf bytes.Buffer
+	shell.RunArgs([]string{"usqlgen", "list", "main-template"}, &buf, nil)
+	require.Contains(t, buf.String(), "package main\n")
+	require.Contains(t, buf.String(), "origMain()")
+}
@@ -0,0 +1,225 @@
+// Package sign creates and verifies detached signatures of files, produced by usqlgen, with SSH or ed25519 keys.
+// Signatures are created and verified offline, in the SSHSIG format, so ssh-keygen -Y verify can also check them.
+package sign
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ansel1/merry/v2"
+	"github.com/murfffi/gorich/helperr"
+	"golang.org/x/crypto/ssh"
+)
+
+// Extension is appended to the path of a signed file to get the path of its signature
+const Extension = ".sig"
+
+// PassphraseEnv is the environment variable with the passphrase of an encrypted private key
+const PassphraseEnv = "USQLGEN_SIGN_PASSPHRASE"
+
+// Namespace is the SSHSIG namespace of signatures. It ensures that the signature can't be reused for
+// other purposes of the same key e.g. SSH authentication. "file" is the namespace ssh-keygen suggests for files.
+const Namespace = "file"
+
+// Signatures are in the SSHSIG format of OpenSSH, documented in PROTOCOL.sshsig
+const (
+	sshsigMagic     = "SSHSIG"
+	sshsigVersion   = 1
+	hashAlgorithm   = "sha512"
+	armorBegin      = "-----BEGIN SSH SIGNATURE-----"
+	armorEnd        = "-----END SSH SIGNATURE-----"
+	armorLineLength = 70
+)
+
+// sshsigBlob is an SSHSIG signature, after the magic preamble
+type sshsigBlob struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// LoadSigner reads a private key in OpenSSH, PKCS#8 (including ed25519), PKCS#1 or SEC 1 PEM format.
+// If the key is encrypted, the passphrase is read from the PassphraseEnv environment variable.
+func LoadSigner(keyPath string) (ssh.Signer, error) {
+	keyData, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	signer, err := ssh.ParsePrivateKey(keyData)
+	var missingErr *ssh.PassphraseMissingError
+	if errors.As(err, &missingErr) {
+		passphrase, ok := os.LookupEnv(PassphraseEnv)
+		if !ok {
+			return nil, merry.Errorf("private key %s is encrypted; set its passphrase in env. var %s", keyPath, PassphraseEnv)
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(keyData, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, merry.Prependf(err, "failed to read private key %s", keyPath)
+	}
+	return signer, nil
+}
+
+// LoadPublicKey reads a public key in authorized_keys format e.g. a .pub file created by ssh-keygen,
+// or in PKIX PEM format e.g. created by openssl
+func LoadPublicKey(keyPath string) (ssh.PublicKey, error) {
+	keyData, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if block, _ := pem.Decode(keyData); block != nil {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, merry.Prependf(err, "failed to read public key %s", keyPath)
+		}
+		publicKey, err := ssh.NewPublicKey(key)
+		return publicKey, merry.Prependf(err, "unsupported public key %s", keyPath)
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(keyData)
+	return publicKey, merry.Prependf(err, "failed to read public key %s", keyPath)
+}
+
+// File signs the file and writes the signature to the file path with Extension.
+// It returns the path of the signature.
+func File(signer ssh.Signer, path string) (string, error) {
+	digest, err := fileDigest(path, hashAlgorithm)
+	if err != nil {
+		return "", err
+	}
+	signature, err := signData(signer, signedData(hashAlgorithm, digest))
+	if err != nil {
+		return "", merry.Prependf(err, "failed to sign %s", path)
+	}
+	blob := sshsigBlob{
+		Version:       sshsigVersion,
+		PublicKey:     signer.PublicKey().Marshal(),
+		Namespace:     Namespace,
+		HashAlgorithm: hashAlgorithm,
+		Signature:     ssh.Marshal(signature),
+	}
+	sigPath := path + Extension
+	err = os.WriteFile(sigPath, armor(append([]byte(sshsigMagic), ssh.Marshal(blob)...)), 0644)
+	return sigPath, merry.Wrap(err)
+}
+
+// signData signs data with the signer. RSA keys sign with SHA-512 because ssh-rsa signatures use SHA-1.
+func signData(signer ssh.Signer, data []byte) (*ssh.Signature, error) {
+	if signer.PublicKey().Type() != ssh.KeyAlgoRSA {
+		return signer.Sign(rand.Reader, data)
+	}
+	algorithmSigner, ok := signer.(ssh.AlgorithmSigner)
+	if !ok {
+		return nil, merry.New("the RSA key doesn't support rsa-sha2-512 signatures")
+	}
+	return algorithmSigner.SignWithAlgorithm(rand.Reader, data, ssh.KeyAlgoRSASHA512)
+}
+
+// Verify checks that the signature in sigPath is a valid signature of the file with the given key
+func Verify(publicKey ssh.PublicKey, path string, sigPath string) error {
+	armored, err := os.ReadFile(sigPath)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	wire, err := dearmor(armored)
+	if err != nil {
+		return merry.Prependf(err, "invalid signature file %s", sigPath)
+	}
+	var blob sshsigBlob
+	var signature ssh.Signature
+	if !bytes.HasPrefix(wire, []byte(sshsigMagic)) {
+		err = merry.New("not an SSH signature")
+	} else if err = ssh.Unmarshal(wire[len(sshsigMagic):], &blob); err == nil {
+		err = ssh.Unmarshal(blob.Signature, &signature)
+	}
+	if err != nil {
+		return merry.Prependf(err, "invalid signature file %s", sigPath)
+	}
+	switch {
+	case blob.Version != sshsigVersion:
+		return merry.Errorf("signature %s has unsupported version %d", sigPath, blob.Version)
+	case blob.Namespace != Namespace:
+		return merry.Errorf("signature %s has namespace %q instead of %q", sigPath, blob.Namespace, Namespace)
+	case signature.Format == ssh.KeyAlgoRSA:
+		return merry.Errorf("signature %s uses ssh-rsa, which relies on SHA-1 and is not accepted", sigPath)
+	case !bytes.Equal(blob.PublicKey, publicKey.Marshal()):
+		return merry.Errorf("signature %s doesn't match %s: it was made with a different key", sigPath, path)
+	}
+	digest, err := fileDigest(path, blob.HashAlgorithm)
+	if err != nil {
+		return err
+	}
+	err = publicKey.Verify(signedData(blob.HashAlgorithm, digest), &signature)
+	return merry.Prependf(err, "signature %s doesn't match %s", sigPath, path)
+}
+
+// fileDigest returns the hash of the file with the SSHSIG hash algorithm
+func fileDigest(path string, algorithm string) ([]byte, error) {
+	var hasher hash.Hash
+	switch algorithm {
+	case "sha512":
+		hasher = sha512.New()
+	case "sha256":
+		hasher = sha256.New()
+	default:
+		return nil, merry.Errorf("unsupported signature hash algorithm %q", algorithm)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	defer helperr.CloseQuietly(file)
+	_, err = io.Copy(hasher, file)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return hasher.Sum(nil), nil
+}
+
+// signedData returns the SSHSIG data that is signed for a file with the given digest
+func signedData(algorithm string, digest []byte) []byte {
+	data := struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{Namespace: Namespace, HashAlgorithm: algorithm, Hash: digest}
+	return append([]byte(sshsigMagic), ssh.Marshal(data)...)
+}
+
+// armor encodes an SSHSIG blob like ssh-keygen -Y sign
+func armor(blob []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(blob)
+	var buf bytes.Buffer
+	buf.WriteString(armorBegin + "\n")
+	for len(encoded) > armorLineLength {
+		buf.WriteString(encoded[:armorLineLength] + "\n")
+		encoded = encoded[armorLineLength:]
+	}
+	buf.WriteString(encoded + "\n" + armorEnd + "\n")
+	return buf.Bytes()
+}
+
+func dearmor(armored []byte) ([]byte, error) {
+	text := strings.TrimSpace(string(armored))
+	body, ok := strings.CutPrefix(text, armorBegin)
+	if ok {
+		body, ok = strings.CutSuffix(body, armorEnd)
+	}
+	if !ok {
+		return nil, merry.New("expected an armored SSH signature")
+	}
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(body), ""))
+}
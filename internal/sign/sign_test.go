@@ -0,0 +1,184 @@
+package sign_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/sclgo/usqlgen/internal/sign"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	dir := t.TempDir()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	file := filepath.Join(dir, "usql")
+	require.NoError(t, os.WriteFile(file, []byte("binary"), 0644))
+
+	keyFormats := map[string]struct {
+		private []byte
+		public  []byte
+	}{
+		"pem":     {private: pkcs8PEM(t, privateKey), public: pkixPEM(t, publicKey)},
+		"openssh": {private: openSSHPEM(t, privateKey, ""), public: authorizedKey(t, publicKey)},
+	}
+	for name, format := range keyFormats {
+		t.Run(name, func(t *testing.T) {
+			privatePath, publicPath := writeKeys(t, format.private, format.public)
+			signer, err := sign.LoadSigner(privatePath)
+			require.NoError(t, err)
+			sigPath, err := sign.File(signer, file)
+			require.NoError(t, err)
+			require.Equal(t, file+sign.Extension, sigPath)
+
+			verifier, err := sign.LoadPublicKey(publicPath)
+			require.NoError(t, err)
+			require.NoError(t, sign.Verify(verifier, file, sigPath))
+		})
+	}
+
+	t.Run("tampered", func(t *testing.T) {
+		privatePath, publicPath := writeKeys(t, pkcs8PEM(t, privateKey), pkixPEM(t, publicKey))
+		signer, err := sign.LoadSigner(privatePath)
+		require.NoError(t, err)
+		tampered := filepath.Join(dir, "tampered")
+		require.NoError(t, os.WriteFile(tampered, []byte("binary"), 0644))
+		sigPath, err := sign.File(signer, tampered)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(tampered, []byte("binary!"), 0644))
+
+		verifier, err := sign.LoadPublicKey(publicPath)
+		require.NoError(t, err)
+		require.ErrorContains(t, sign.Verify(verifier, tampered, sigPath), "doesn't match")
+	})
+
+	t.Run("encrypted key", func(t *testing.T) {
+		privatePath, _ := writeKeys(t, openSSHPEM(t, privateKey, "secret"), nil)
+		t.Setenv(sign.PassphraseEnv, "")
+		require.NoError(t, os.Unsetenv(sign.PassphraseEnv))
+		_, err := sign.LoadSigner(privatePath)
+		require.ErrorContains(t, err, sign.PassphraseEnv)
+
+		t.Setenv(sign.PassphraseEnv, "secret")
+		_, err = sign.LoadSigner(privatePath)
+		require.NoError(t, err)
+	})
+}
+
+func TestSignAndVerify_SSHKeygen(t *testing.T) {
+	sshKeygen, err := exec.LookPath("ssh-keygen")
+	if err != nil {
+		t.Skip("ssh-keygen is not available")
+	}
+	dir := t.TempDir()
+	file := filepath.Join(dir, "usql")
+	require.NoError(t, os.WriteFile(file, []byte("binary"), 0644))
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(rsaKey, "")
+	require.NoError(t, err)
+	sshPublicKey, err := ssh.NewPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	privatePath, publicPath := writeKeys(t, pem.EncodeToMemory(block), ssh.MarshalAuthorizedKey(sshPublicKey))
+
+	t.Run("usqlgen signs", func(t *testing.T) {
+		signer, err := sign.LoadSigner(privatePath)
+		require.NoError(t, err)
+		sigPath, err := sign.File(signer, file)
+		require.NoError(t, err)
+
+		cmd := exec.Command(sshKeygen, "-Y", "check-novalidate", "-n", sign.Namespace, "-s", sigPath)
+		cmd.Stdin = bytes.NewReader([]byte("binary"))
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+	})
+
+	t.Run("ssh-keygen signs", func(t *testing.T) {
+		signed := filepath.Join(dir, "signed")
+		require.NoError(t, os.WriteFile(signed, []byte("binary"), 0644))
+		output, err := exec.Command(sshKeygen, "-Y", "sign", "-f", privatePath, "-n", sign.Namespace, signed).CombinedOutput()
+		require.NoError(t, err, string(output))
+
+		verifier, err := sign.LoadPublicKey(publicPath)
+		require.NoError(t, err)
+		require.NoError(t, sign.Verify(verifier, signed, signed+sign.Extension))
+	})
+}
+
+func TestVerify_RejectsSHA1(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(rsaKey)
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "usql")
+	require.NoError(t, os.WriteFile(file, []byte("binary"), 0644))
+
+	// an SSHSIG signature, as created by signing with the legacy ssh-rsa algorithm
+	digest := sha512.Sum512([]byte("binary"))
+	signed := append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Namespace, Reserved, HashAlgorithm string
+		Hash                               []byte
+	}{Namespace: sign.Namespace, HashAlgorithm: "sha512", Hash: digest[:]})...)
+	signature, err := signer.(ssh.AlgorithmSigner).SignWithAlgorithm(rand.Reader, signed, ssh.KeyAlgoRSA)
+	require.NoError(t, err)
+	blob := append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Version                            uint32
+		PublicKey                          []byte
+		Namespace, Reserved, HashAlgorithm string
+		Signature                          []byte
+	}{1, signer.PublicKey().Marshal(), sign.Namespace, "", "sha512", ssh.Marshal(signature)})...)
+	armored := "-----BEGIN SSH SIGNATURE-----\n" + base64.StdEncoding.EncodeToString(blob) + "\n-----END SSH SIGNATURE-----\n"
+	require.NoError(t, os.WriteFile(file+sign.Extension, []byte(armored), 0644))
+
+	err = sign.Verify(signer.PublicKey(), file, file+sign.Extension)
+	require.ErrorContains(t, err, "uses ssh-rsa")
+}
+
+func writeKeys(t *testing.T, private []byte, public []byte) (string, string) {
+	dir := t.TempDir()
+	privatePath, publicPath := filepath.Join(dir, "key"), filepath.Join(dir, "key.pub")
+	require.NoError(t, os.WriteFile(privatePath, private, 0600))
+	require.NoError(t, os.WriteFile(publicPath, public, 0600))
+	return privatePath, publicPath
+}
+
+func pkcs8PEM(t *testing.T, key ed25519.PrivateKey) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func pkixPEM(t *testing.T, key ed25519.PublicKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func openSSHPEM(t *testing.T, key ed25519.PrivateKey, passphrase string) []byte {
+	var block *pem.Block
+	var err error
+	if passphrase == "" {
+		block, err = ssh.MarshalPrivateKey(key, "")
+	} else {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte(passphrase))
+	}
+	require.NoError(t, err)
+	return pem.EncodeToMemory(block)
+}
+
+func authorizedKey(t *testing.T, key ed25519.PublicKey) []byte {
+	publicKey, err := ssh.NewPublicKey(key)
+	require.NoError(t, err)
+	return ssh.MarshalAuthorizedKey(publicKey)
+}